@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/loadgen"
+)
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitList is a stringList whose values may also be comma separated
+type splitList struct {
+	*stringList
+}
+
+func (l splitList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l.stringList = append(*l.stringList, part)
+		}
+	}
+	return nil
+}
+
+// parseFlags reads the options of a run from the command line
+func parseFlags() *loadgen.RunConfig {
+	cfg := loadgen.NewRunConfig()
+	flag.IntVar(&cfg.Rate, "rps", cfg.Rate, "requests per second")
+	flag.IntVar(&cfg.Duration, "dur", cfg.Duration, "duration in seconds")
+	flag.IntVar(&cfg.MaxInFlight, "max-inflight", cfg.MaxInFlight, "maximum number of requests in flight at once")
+	flag.IntVar(&cfg.VirtualUsers, "vus", cfg.VirtualUsers, "run this many closed-loop virtual users, each repeating the scenario's session, instead of a request rate")
+	flag.StringVar(&cfg.ThinkTime, "think-time", cfg.ThinkTime, "pause of virtual users after each request: constant:1s, uniform:500ms-2s or exponential:1s (overrides the session's)")
+	flag.StringVar(&cfg.URL, "url", cfg.URL, "url to make requests to, or the base url of the scenario")
+	flag.StringVar(&cfg.ScenarioFile, "scenario", cfg.ScenarioFile, "YAML or JSON file describing a weighted mix of requests")
+	flag.StringVar(&cfg.Stages, "stages", cfg.Stages, "load stages as duration:rate or duration:from-to, e.g. 60s:10-500,5m:500,30s:500-0 (overrides -rps and -dur)")
+	flag.BoolVar(&cfg.Transport.KeepAlive, "keep-alive", cfg.Transport.KeepAlive, "reuse connections between requests; -keep-alive=false opens a new connection for every request")
+	flag.IntVar(&cfg.Transport.MaxIdleConnsPerHost, "max-idle-per-host", cfg.Transport.MaxIdleConnsPerHost, "idle connections kept open per host (0 keeps the net/http default of 2)")
+	flag.IntVar(&cfg.Transport.MaxConnsPerHost, "max-conns-per-host", cfg.Transport.MaxConnsPerHost, "cap on connections per host, idle or in use (0 means no cap)")
+	flag.DurationVar(&cfg.Transport.Timeout, "timeout", cfg.Transport.Timeout, "timeout of a request, reading the response body included")
+	flag.StringVar(&cfg.Transport.HTTP2, "http2", cfg.Transport.HTTP2, "HTTP/2: auto (negotiated over TLS), off (HTTP/1.1 only) or h2c (HTTP/2 without TLS, e.g. against the bookstore on :9011)")
+	flag.BoolVar(&cfg.Transport.Insecure, "insecure", cfg.Transport.Insecure, "skip verification of the server's TLS certificate")
+	flag.StringVar(&cfg.Transport.CACert, "ca-cert", cfg.Transport.CACert, "PEM file of CA certificates to trust instead of the system ones")
+	flag.StringVar(&cfg.Transport.ClientCert, "cert", cfg.Transport.ClientCert, "PEM client certificate for TLS client authentication (needs -key)")
+	flag.StringVar(&cfg.Transport.ClientKey, "key", cfg.Transport.ClientKey, "PEM private key of the client certificate")
+	flag.StringVar(&cfg.Transport.Proxy, "proxy", cfg.Transport.Proxy, "proxy url for the requests (default: from HTTP_PROXY and HTTPS_PROXY)")
+	flag.BoolVar(&cfg.Transport.DisableCompression, "disable-compression", cfg.Transport.DisableCompression, "do not ask the server for gzip compressed responses")
+	flag.Var((*stringList)(&cfg.Thresholds), "threshold", "pass/fail threshold such as 'p95 < 200ms', '*: error_rate < 1%' for every endpoint or '<endpoint>: p99 < 1s'; may be repeated")
+	flag.IntVar(&cfg.MaxErrors, "max-errors", cfg.MaxErrors, "abort the run once this many requests have returned an error or a 5xx status (0 means never)")
+	flag.Var((*stringList)(&cfg.AbortOn), "abort-on", "abort the run when a condition in the threshold syntax holds for the results so far, e.g. 'error_rate > 50%' or 'p99 > 2s'; checked every interval, may be repeated")
+	flag.Var(splitList{(*stringList)(&cfg.Agents)}, "agents", "comma separated host:port list of agents to split the load across, instead of sending it from this process; may be repeated")
+	flag.StringVar(&cfg.ReplayFile, "replay", cfg.ReplayFile, "send the requests of a capture (JSONL or .har) to -url at the offsets they were captured at, instead of a scenario")
+	flag.Float64Var(&cfg.Speed, "speed", cfg.Speed, "speed factor of -replay, e.g. 2 replays twice as fast and 0.5 at half speed")
+	flag.StringVar(&cfg.RecordFile, "record", cfg.RecordFile, "run a proxy to -url that records the requests through it to this file (JSONL, or HAR if it ends in .har) instead of running a test")
+	flag.StringVar(&cfg.RecordAddr, "record-addr", cfg.RecordAddr, "address the recording proxy of -record listens on")
+	flag.Var((*stringList)(&cfg.RecordSkipHeaders), "record-skip-header", "header left out of the capture, such as Authorization or Cookie; may be repeated")
+	flag.StringVar(&cfg.ImportFile, "import", cfg.ImportFile, "generate a scenario from a capture (.har or .jsonl, a request per endpoint) or an OpenAPI/Swagger spec (a request per operation) instead of running a test")
+	flag.StringVar(&cfg.ImportOut, "import-out", cfg.ImportOut, "file to write the scenario generated by -import to, instead of stdout")
+	flag.BoolVar(&cfg.Search, "search", cfg.Search, "search for the highest rate that meets the thresholds (e.g. -threshold 'p99 < 100ms'), holding each rate for -search-hold, instead of running the load profile")
+	flag.Float64Var(&cfg.SearchMin, "search-min", cfg.SearchMin, "rate of the first level of -search, in requests per second")
+	flag.Float64Var(&cfg.SearchMax, "search-max", cfg.SearchMax, "highest rate tried by -search, unbounded if 0")
+	flag.Float64Var(&cfg.SearchStep, "search-step", cfg.SearchStep, "increase of the rate while -search steps up, until a level fails; the rate doubles if 0")
+	flag.DurationVar(&cfg.SearchHold, "search-hold", cfg.SearchHold, "how long -search holds each rate")
+	flag.Float64Var(&cfg.SearchPrecision, "search-precision", cfg.SearchPrecision, "gap in percent between the highest passing and lowest failing rate at which -search stops")
+	flag.StringVar(&cfg.AgentAddr, "agent", cfg.AgentAddr, "run as an agent listening on this address for jobs from a coordinator; :7070 listens on localhost only, 0.0.0.0:7070 on every interface")
+	flag.StringVar(&cfg.AgentToken, "agent-token", cfg.AgentToken, "shared token an agent requires from its coordinator, and the coordinator of -agents sends (default: $"+loadgen.AgentTokenEnv+")")
+	flag.StringVar(&cfg.Live, "live", cfg.Live, "live progress view: auto, table (redrawn in place), plain (one line per interval) or off")
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "length of an interval of the live view and the time series")
+	flag.StringVar(&cfg.OutDir, "out", cfg.OutDir, "directory to write summary.json, the per-request log and junit.xml to")
+	flag.StringVar(&cfg.RawFormat, "raw-format", cfg.RawFormat, "format of the per-request log written to -out: csv, jsonl or none (not written with -agents)")
+	flag.StringVar(&cfg.TimeSeriesFormat, "timeseries-format", cfg.TimeSeriesFormat, "format of the per-interval time series written to -out: csv, jsonl or none")
+	flag.Float64Var(&cfg.JUnitMaxErrorRate, "junit-max-error-rate", cfg.JUnitMaxErrorRate, "error rate in percent above which an endpoint fails in junit.xml")
+	flag.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "serve live metrics in the Prometheus text format on this address (e.g. :9464) at /metrics during the run")
+	flag.StringVar(&cfg.PushURL, "push-url", cfg.PushURL, "push the metrics every interval to this Pushgateway compatible url, e.g. http://localhost:9091/metrics/job/loadtest")
+	flag.BoolVar(&cfg.HTMLReport, "html", cfg.HTMLReport, "write a self-contained report.html to -out")
+	flag.StringVar(&cfg.HTMLFrom, "html-from", cfg.HTMLFrom, "write report.html into this directory of earlier results (summary.json and time series) instead of running a test")
+	flag.StringVar(&cfg.BaselineFile, "baseline", cfg.BaselineFile, "summary.json of an earlier run to compare this run with")
+	flag.StringVar(&cfg.CompareFile, "compare", cfg.CompareFile, "compare this summary.json with -baseline instead of running a test")
+	flag.Float64Var(&cfg.Tolerance, "tolerance", cfg.Tolerance, "change in percent of throughput or latency against the baseline that counts as a regression")
+	flag.Float64Var(&cfg.ErrorTolerance, "error-tolerance", cfg.ErrorTolerance, "rise of the error rate in percentage points against the baseline that counts as a regression")
+	flag.Parse()
+	// Read from the environment after parsing, so the token is not printed
+	// as a default by -help
+	if cfg.AgentToken == "" {
+		cfg.AgentToken = os.Getenv(loadgen.AgentTokenEnv)
+	}
+	return cfg
+}
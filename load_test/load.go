@@ -1,185 +1,473 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"runtime"
-	"sync"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/capture"
+	"github.com/Bappy60/BookStore_in_Go/pkg/loadgen"
 )
 
-// Worker is a struct that represents a concurrent worker
-type Worker struct {
-	id               int          // worker id
-	url              string       // url to make requests to
-	rpsForEachWorker int          // Requests per second for each worker
-	client           *http.Client // HTTP client to use
-}
+const (
+	exitThresholdsFailed = 2 // a threshold is not met
+	exitRegression       = 3 // the run is slower than its baseline
+	exitAborted          = 4 // the run was stopped before the end of its profile
+)
 
-// Result is a struct that holds the result of a request
-type Result struct {
-	workerID int           // worker id
-	status   int           // status code
-	latency  time.Duration // latency
-	err      error         // error if any
-}
+// main function
+func main() {
+	startTime := time.Now()
 
-// NewWorker creates a new worker with the given parameters
-func NewWorker(id int, url string, rpsForEachWorker int, client *http.Client) *Worker {
-	return &Worker{
-		id:               id,
-		url:              url,
-		rpsForEachWorker: rpsForEachWorker,
-		client:           client,
-	}
-}
+	// parse command line arguments
+	cfg := parseFlags()
 
-// Run runs the worker and sends the results to the given channel
-func (w *Worker) Run(results chan<- Result, duration time.Duration) {
-	defer func() {
-		// handle panic gracefully
-		if r := recover(); r != nil {
-			fmt.Println("Worker", w.id, "panicked:", r)
+	// Serve jobs from a coordinator instead of running a test
+	if cfg.AgentAddr != "" {
+		if err := loadgen.ServeAgent(cfg.AgentAddr, cfg.AgentToken); err != nil {
+			fmt.Println("Error running agent:", err)
+			os.Exit(1)
 		}
-	}()
-
-	// Calculate request rate per second for each worker
-	requestRatePerSecond := w.rpsForEachWorker / int(duration)
-	// Calculate sleep duration between each request
-	sleepDuration := time.Second / time.Duration(requestRatePerSecond)
-
-	// Loop for the duration of d seconds
-	for j := 0; j < int(duration); j++ {
-		// Loop to make requests at the desired rate
-		for i := 0; i < requestRatePerSecond; i++ {
-			// Make a GET request and measure the latency
-			start := time.Now()
-			resp, err := w.client.Get(w.url)
-			latency := time.Since(start)
-
-			// Send the result to the channel
-			result := Result{w.id, 0, latency, err}
-			if err == nil {
-				// Close the response body and get the status code
-				defer resp.Body.Close()
-				result.status = resp.StatusCode
-			}
-			results <- result
+		return
+	}
 
-			// Sleep for the calculated duration before making the next request
-			time.Sleep(sleepDuration)
+	// Record the traffic through a proxy instead of running a test
+	if cfg.RecordFile != "" {
+		if err := record(cfg); err != nil {
+			fmt.Println("Error recording:", err)
+			os.Exit(1)
 		}
+		return
 	}
-}
 
-// main function
-func main() {
-	startTime := time.Now()
-
-	// parse command line arguments
-	var reqPerSec, duration, totalRequests int
-	var url string
-	flag.IntVar(&reqPerSec, "rps", 10, "requests per second")
-	flag.IntVar(&duration, "dur", 10, "duration in seconds")
-	flag.StringVar(&url, "url", "https://example.com", "url to make requests to")
-	flag.Parse()
+	// Generate a scenario instead of running a test
+	if cfg.ImportFile != "" {
+		if err := importScenario(cfg); err != nil {
+			fmt.Println("Error importing scenario:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Calculate the total number of requests needed
-	totalRequests = reqPerSec * duration
+	// Write the HTML report of earlier results instead of running a test
+	if cfg.HTMLFrom != "" {
+		path, err := loadgen.WriteHTMLReportFrom(cfg.HTMLFrom)
+		if err != nil {
+			fmt.Println("Error writing HTML report:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Report written to", path)
+		return
+	}
 
-	// determine the number of workers based on the number of CPUs
-	workers := runtime.NumCPU()
+	// Load the baseline first, so a wrong path fails before the test runs
+	var baseline *loadgen.Summary
+	if cfg.BaselineFile != "" {
+		var err error
+		if baseline, err = loadgen.LoadSummary(cfg.BaselineFile); err != nil {
+			fmt.Println("Error loading baseline:", err)
+			os.Exit(1)
+		}
+	}
 
-	// Calculate the number of requests per worker
-	requestsPerWorker := totalRequests / workers
+	// Compare two earlier runs instead of running a test
+	if cfg.CompareFile != "" {
+		if baseline == nil {
+			fmt.Println("-compare needs a -baseline to compare with")
+			os.Exit(1)
+		}
+		current, err := loadgen.LoadSummary(cfg.CompareFile)
+		if err != nil {
+			fmt.Println("Error loading summary:", err)
+			os.Exit(1)
+		}
+		if !loadgen.PrintComparison(loadgen.Compare(cfg.BaselineFile, baseline, current, cfg.Tolerance, cfg.ErrorTolerance)) {
+			fmt.Println("Regressions found")
+			os.Exit(exitRegression)
+		}
+		return
+	}
 
-	// Create a channel for results
-	results := make(chan Result, totalRequests)
+	if err := cfg.Validate(); err != nil {
+		fmt.Println("Invalid options:", err)
+		os.Exit(1)
+	}
 
-	// Create an HTTP client with a timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	// Load the scenario, or fall back to GET requests against a single url
+	scenario := loadgen.SingleURLScenario(cfg.URL)
+	var replay *loadgen.Replay
+	if cfg.ReplayFile != "" {
+		if cfg.ScenarioFile != "" || cfg.VirtualUsers > 0 || len(cfg.Agents) > 0 {
+			fmt.Println("-replay cannot be combined with -scenario, -vus or -agents")
+			os.Exit(1)
+		}
+		captured, err := capture.Load(cfg.ReplayFile)
+		if err != nil {
+			fmt.Println("Error loading capture:", err)
+			os.Exit(1)
+		}
+		if replay, err = loadgen.NewReplay(captured); err != nil {
+			fmt.Println("Invalid capture:", err)
+			os.Exit(1)
+		}
+		if replay.Skipped > 0 {
+			fmt.Printf("Skipping %d of %d captured requests, whose body was not recorded\n", replay.Skipped, len(captured))
+		}
+		scenario = replay.Scenario
+	}
+	if cfg.ScenarioFile != "" {
+		var err error
+		if scenario, err = loadgen.LoadScenario(cfg.ScenarioFile); err != nil {
+			fmt.Println("Error loading scenario:", err)
+			os.Exit(1)
+		}
+	}
+	if err := scenario.Prepare(cfg.URL); err != nil {
+		fmt.Println("Invalid scenario:", err)
+		os.Exit(1)
 	}
 
-	// Create a wait group for workers
-	wg := &sync.WaitGroup{}
-	wg.Add(workers)
+	// Build the load profile: -stages wins over the scenario's stages, which
+	// win over a flat -rps for -dur seconds
+	profile := loadgen.ConstantProfile(float64(cfg.Rate), time.Duration(cfg.Duration)*time.Second)
+	if len(scenario.Stages) > 0 {
+		profile = &loadgen.Profile{Stages: scenario.Stages}
+	}
+	if cfg.Stages != "" {
+		stages, err := loadgen.ParseStages(cfg.Stages)
+		if err != nil {
+			fmt.Println("Invalid stages:", err)
+			os.Exit(1)
+		}
+		profile = &loadgen.Profile{Stages: stages}
+	}
+	// Virtual users run for -dur seconds, or the length of -stages; the
+	// rates of the stages do not apply to them
+	if cfg.VirtualUsers > 0 {
+		duration := time.Duration(cfg.Duration) * time.Second
+		if cfg.Stages != "" {
+			duration = profile.Duration()
+		}
+		profile = &loadgen.Profile{Stages: []loadgen.Stage{{Name: "virtual users", Duration: loadgen.Duration(duration)}}}
+	}
+	if err := profile.Prepare(); err != nil {
+		fmt.Println("Invalid load profile:", err)
+		os.Exit(1)
+	}
+	// A replay follows the timing of the capture instead
+	var scheduler loadgen.Scheduler
+	if replay != nil {
+		replayScheduler, err := replay.Scheduler(cfg.Speed, cfg.MaxInFlight)
+		if err != nil {
+			fmt.Println("Invalid replay:", err)
+			os.Exit(1)
+		}
+		scheduler = replayScheduler
+		profile = scheduler.Profile()
+	}
 
-	// Create a map to store status code metrics
-	statusMetrics := make(map[int]*StatusCodeMetrics)
+	// The -think-time flag wins over the think time of the scenario's session
+	thinkTime := scenario.SessionThinkTime()
+	if cfg.ThinkTime != "" {
+		var err error
+		if thinkTime, err = loadgen.ParseThinkTime(cfg.ThinkTime); err != nil {
+			fmt.Println("Invalid think time:", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.VirtualUsers > 0 && len(cfg.Agents) > 0 {
+		fmt.Println("Virtual users cannot be split across agents")
+		os.Exit(1)
+	}
 
-	// Create and run workers
-	for i := 0; i < workers; i++ {
-		worker := NewWorker(i, url, requestsPerWorker, client)
-		go func() {
-			worker.Run(results, time.Duration(duration))
-			wg.Done()
-		}()
+	// Create the HTTP client; agents build their own from the same options
+	client, err := cfg.Transport.NewClient()
+	if err != nil {
+		fmt.Println("Invalid transport:", err)
+		os.Exit(1)
 	}
 
-	// Wait for all workers to finish
-	wg.Wait()
-	close(results)
+	// Collect the thresholds from the scenario and the command line
+	thresholds := loadgen.NewThresholdSet()
+	if err := scenario.AddThresholds(thresholds); err != nil {
+		fmt.Println("Invalid threshold:", err)
+		os.Exit(1)
+	}
+	for _, value := range cfg.Thresholds {
+		if err := thresholds.AddFlag(value); err != nil {
+			fmt.Println("Invalid threshold:", err)
+			os.Exit(1)
+		}
+	}
 
-	// Collect and print metrics
-	var totalErrors int
-	var minLatency, maxLatency, sumLatency int64
-	minLatency = 1<<63 - 1 // max int64 value
+	runner := &loadgen.Runner{
+		Config:     cfg,
+		Scenario:   scenario,
+		Profile:    profile,
+		Target:     loadgen.NewHTTPTarget(client),
+		Scheduler:  scheduler,
+		ThinkTime:  thinkTime,
+		Thresholds: thresholds,
+		Baseline:   baseline,
+		Reporters:  []loadgen.Reporter{loadgen.ConsoleReporter{}},
+	}
 
-	// Iterate over the results
-	for result := range results {
-		if result.err != nil {
-			totalErrors++
-		}
-		sumLatency += int64(result.latency)
-		if result.latency < time.Duration(minLatency) {
-			minLatency = int64(result.latency)
+	// Search for the highest rate meeting the thresholds instead of running the profile
+	if cfg.Search {
+		if cfg.VirtualUsers > 0 || replay != nil {
+			fmt.Println("-search cannot be combined with -vus or -replay")
+			os.Exit(1)
 		}
-		if result.latency > time.Duration(maxLatency) {
-			maxLatency = int64(result.latency)
+		if thresholds.Empty() {
+			fmt.Println("-search needs thresholds to meet, e.g. -threshold 'p99 < 100ms' -threshold 'error_rate < 1%'")
+			os.Exit(1)
 		}
+		code := search(cfg, runner)
+		fmt.Println("Total execution time", time.Since(startTime))
+		os.Exit(code)
+	}
 
-		// Update status code metrics
-		if _, ok := statusMetrics[result.status]; !ok {
-			statusMetrics[result.status] = &StatusCodeMetrics{
-				Count:      0,
-				MinLatency: 1<<63 - 1,
-				MaxLatency: 0,
-				SumLatency: 0,
+	// Create the output directory, the per-request log and the time series
+	if cfg.OutDir != "" {
+		if err := os.MkdirAll(cfg.OutDir, 0755); err != nil {
+			fmt.Println("Error creating output directory:", err)
+			os.Exit(1)
+		}
+		files := &loadgen.FileReporter{Dir: cfg.OutDir, JUnitMaxErrorRate: cfg.JUnitMaxErrorRate}
+		if cfg.RawFormat != "none" && len(cfg.Agents) == 0 {
+			files.RawLog, err = loadgen.NewRawLog(filepath.Join(cfg.OutDir, "requests."+cfg.RawFormat), cfg.RawFormat)
+			if err != nil {
+				fmt.Println("Error creating request log:", err)
+				os.Exit(1)
 			}
+			runner.Sinks = append(runner.Sinks, files.RawLog)
 		}
-		statusMetrics[result.status].Count++
-		statusMetrics[result.status].SumLatency += result.latency
-		if result.latency < time.Duration(statusMetrics[result.status].MinLatency) {
-			statusMetrics[result.status].MinLatency = result.latency
+		if cfg.TimeSeriesFormat != "none" {
+			files.TimeSeries, err = loadgen.NewTimeSeries(filepath.Join(cfg.OutDir, "timeseries."+cfg.TimeSeriesFormat), cfg.TimeSeriesFormat, profile)
+			if err != nil {
+				fmt.Println("Error creating time series:", err)
+				os.Exit(1)
+			}
+			runner.Listeners = append(runner.Listeners, files.TimeSeries)
 		}
-		if result.latency > time.Duration(statusMetrics[result.status].MaxLatency) {
-			statusMetrics[result.status].MaxLatency = result.latency
+		if cfg.HTMLReport {
+			files.HTML = loadgen.NewHTMLReport(profile)
+			runner.Listeners = append(runner.Listeners, files.HTML)
 		}
+		runner.Reporters = append(runner.Reporters, files)
+	}
+
+	// Create the live view and the metrics endpoint, fed with results as they complete
+	if cfg.Live != "off" {
+		dashboard, err := loadgen.NewDashboard(cfg.Live, profile)
+		if err != nil {
+			fmt.Println("Invalid live view:", err)
+			os.Exit(1)
+		}
+		runner.Listeners = append(runner.Listeners, dashboard)
+	}
+	var prometheus *loadgen.Prometheus
+	if cfg.MetricsAddr != "" || cfg.PushURL != "" {
+		prometheus = loadgen.NewPrometheus(profile, cfg.PushURL)
+		runner.Listeners = append(runner.Listeners, prometheus)
+	}
+	if cfg.MetricsAddr != "" {
+		if err := loadgen.ServePrometheus(cfg.MetricsAddr, prometheus); err != nil {
+			fmt.Println("Error serving metrics:", err)
+			os.Exit(1)
+		}
+	}
+
+	// Stop the run early on an abort condition or Ctrl-C, still reporting on what ran
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	aborter, err := loadgen.NewAborter(cancel, cfg.MaxErrors, cfg.AbortOn)
+	if err != nil {
+		fmt.Println("Invalid abort condition:", err)
+		os.Exit(1)
+	}
+	if aborter.Enabled() {
+		runner.Listeners = append(runner.Listeners, aborter)
 	}
 
-	// Calculate average latency
-	avgLatency := float64(sumLatency) / float64(totalRequests)
+	// A first Ctrl-C stops sending and waits for the requests in flight, a
+	// second one exits at once
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Println("\nInterrupted, waiting for requests in flight; press Ctrl-C again to exit at once")
+		aborter.Abort("interrupted")
+	}()
 
-	// Print metrics
-	fmt.Println("Total Number of Requests:", totalRequests)
-	fmt.Println("Average Latency:", time.Duration(avgLatency))
-	fmt.Println("Requests Per Second:", reqPerSec)
-	fmt.Println("Min Latency:", time.Duration(minLatency))
-	fmt.Println("Max Latency:", time.Duration(maxLatency))
-	fmt.Println("Error Rate:", float64(totalErrors)/float64(totalRequests)*100, "%")
-	fmt.Println("Status Code      Counts      Min Latency      Max Latency      Avg Latency")
-	for status, metrics := range statusMetrics {
-		fmt.Printf("%-16d%-12d%-17s%-17s%-17s\n", status, metrics.Count, metrics.MinLatency, metrics.MaxLatency, time.Duration(metrics.SumLatency.Nanoseconds()/int64(metrics.Count)))
+	result, err := runner.Run(ctx)
+	signal.Stop(signals)
+	if result == nil {
+		fmt.Println("Error running the test:", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("Error reporting results:", err)
+	}
+	if prometheus != nil {
+		if err := prometheus.PushError(); err != nil {
+			fmt.Println("Error pushing metrics:", err)
+		}
 	}
 	fmt.Println("Total execution time", time.Since(startTime))
+
+	if result.Aborted != "" {
+		os.Exit(exitAborted)
+	}
+	if !result.Passed() {
+		fmt.Println("Thresholds failed")
+		os.Exit(exitThresholdsFailed)
+	}
+	if result.Regressed() {
+		fmt.Println("Regressions found")
+		os.Exit(exitRegression)
+	}
+}
+
+// record runs a proxy to cfg.URL that records the requests through it, until
+// it is interrupted
+func record(cfg *loadgen.RunConfig) error {
+	recorder, err := capture.NewRecorder(cfg.RecordFile, cfg.RecordSkipHeaders)
+	if err != nil {
+		return err
+	}
+	proxy, err := capture.Proxy(cfg.URL, recorder)
+	if err != nil {
+		recorder.Close()
+		return err
+	}
+	server := &http.Server{Addr: cfg.RecordAddr, Handler: proxy}
+
+	// Stop on Ctrl-C, letting the requests in flight finish first
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		server.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("Recording requests on %s to %s, proxied to %s; press Ctrl-C to stop\n", cfg.RecordAddr, cfg.RecordFile, cfg.URL)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		recorder.Close()
+		return err
+	}
+	if err := recorder.Close(); err != nil {
+		return err
+	}
+	fmt.Println("Capture written to", cfg.RecordFile)
+	return nil
+}
+
+// search runs a search for the highest rate at which runner meets its
+// thresholds, and returns the exit code
+func search(cfg *loadgen.RunConfig, runner *loadgen.Runner) int {
+	s := &loadgen.Search{
+		Runner:    runner,
+		SLO:       runner.Thresholds,
+		MinRate:   cfg.SearchMin,
+		MaxRate:   cfg.SearchMax,
+		Step:      cfg.SearchStep,
+		Hold:      cfg.SearchHold,
+		Precision: cfg.SearchPrecision / 100,
+		MaxErrors: cfg.MaxErrors,
+		AbortOn:   cfg.AbortOn,
+		OnLevel:   loadgen.PrintSearchLevel,
+	}
+
+	// Stop on Ctrl-C, still reporting the levels run; abort conditions stop
+	// the search from within the level they hold for
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Println("\nInterrupted, waiting for requests in flight; press Ctrl-C again to exit at once")
+		cancel(errors.New("interrupted"))
+	}()
+
+	fmt.Printf("Searching for the highest rate from %g req/s, holding each for %s\n", cfg.SearchMin, cfg.SearchHold)
+	result, err := s.Run(ctx)
+	signal.Stop(signals)
+	if err != nil {
+		fmt.Println("Error searching:", err)
+		return 1
+	}
+	fmt.Println()
+	loadgen.PrintSearch(result)
+	if cfg.OutDir != "" {
+		if err := os.MkdirAll(cfg.OutDir, 0755); err != nil {
+			fmt.Println("Error creating output directory:", err)
+			return 1
+		}
+		if err := loadgen.WriteSearch(cfg.OutDir, result); err != nil {
+			fmt.Println("Error writing search results:", err)
+			return 1
+		}
+		fmt.Println("Results written to", cfg.OutDir)
+	}
+
+	switch {
+	case result.Aborted != "":
+		return exitAborted
+	case result.Best() == nil:
+		return exitThresholdsFailed
+	}
+	return 0
 }
 
-// Define a struct to store the status code metrics
-type StatusCodeMetrics struct {
-	Count      int // number of requests with this status code
-	MinLatency time.Duration
-	MaxLatency time.Duration
-	SumLatency time.Duration // sum of latencies for this status code
+// importScenario generates a scenario from the capture or OpenAPI spec of
+// cfg.ImportFile and writes it to cfg.ImportOut, or to stdout
+func importScenario(cfg *loadgen.RunConfig) error {
+	var scenario *loadgen.Scenario
+	switch strings.ToLower(filepath.Ext(cfg.ImportFile)) {
+	case ".har", ".jsonl":
+		captured, err := capture.Load(cfg.ImportFile)
+		if err != nil {
+			return err
+		}
+		if scenario, err = loadgen.ScenarioFromCapture(captured); err != nil {
+			return err
+		}
+	default:
+		var err error
+		if scenario, err = loadgen.ScenarioFromOpenAPI(cfg.ImportFile); err != nil {
+			return err
+		}
+	}
+
+	comment := fmt.Sprintf(`Generated by load_test -import %s
+Review the paths, bodies and weights, then run with:
+  go run ./load_test -scenario <this file> -url <base url>`, cfg.ImportFile)
+	if cfg.ImportOut == "" {
+		return loadgen.WriteScenario(os.Stdout, scenario, comment)
+	}
+	file, err := os.Create(cfg.ImportOut)
+	if err != nil {
+		return err
+	}
+	if err := loadgen.WriteScenario(file, scenario, comment); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Scenario with %d requests written to %s\n", len(scenario.Requests), cfg.ImportOut)
+	return nil
 }
@@ -0,0 +1,352 @@
+// Package capture records the requests served by a handler, for load_test to
+// replay or turn into a scenario. It is kept apart from pkg/loadgen so the
+// bookstore server can record its traffic without linking the load tester.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxBody is the largest request body recorded; larger bodies are left out
+// and marked as truncated
+const maxBody = 1 << 20
+
+// hopHeaders are not recorded: they describe a single connection, and the
+// client replaying the traffic sets its own
+var hopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+	"Accept-Encoding":     true,
+}
+
+// HopHeader reports whether a canonical header name describes a single
+// connection, so it is not recorded or replayed
+func HopHeader(name string) bool {
+	return hopHeaders[name]
+}
+
+// Request is one request recorded from real traffic, a line of a JSONL
+// capture
+type Request struct {
+	Time          time.Time         `json:"time"` // time the request arrived
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	Query         string            `json:"query,omitempty"` // raw query, without "?"
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	BodyBase64    bool              `json:"body_base64,omitempty"`    // Body is base64, the request body was not text
+	BodyTruncated bool              `json:"body_truncated,omitempty"` // the body was too large to record, or missing from a HAR file
+	Status        int               `json:"status"`
+	DurationMs    float64           `json:"duration_ms"` // time the server took to respond
+}
+
+// RequestBody returns the recorded body as sent
+func (c *Request) RequestBody() ([]byte, error) {
+	if c.BodyBase64 {
+		return base64.StdEncoding.DecodeString(c.Body)
+	}
+	return []byte(c.Body), nil
+}
+
+// Recorder records the requests served by a handler to a JSONL file, or to a
+// HAR file if the path ends in .har. Requests are written as they complete,
+// so a long capture does not grow in memory; Close ends a HAR file's list of
+// entries.
+type Recorder struct {
+	mu          sync.Mutex
+	file        *os.File
+	buf         *bufio.Writer
+	har         bool // write HAR entries instead of JSONL lines
+	entries     int  // HAR entries written
+	skipHeaders map[string]bool
+	err         error // first error writing the capture, returned by Close
+}
+
+// NewRecorder creates the capture file at path. Headers named in
+// skipHeaders, such as Authorization or Cookie, are not recorded.
+func NewRecorder(path string, skipHeaders []string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Recorder{file: file, buf: bufio.NewWriter(file), skipHeaders: make(map[string]bool)}
+	for _, name := range skipHeaders {
+		c.skipHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+	if strings.EqualFold(filepath.Ext(path), ".har") {
+		// The log is written up to its list of entries, which Close ends
+		c.har = true
+		creator, _ := json.Marshal(HARCreator{Name: "load_test", Version: "1"})
+		fmt.Fprintf(c.buf, "{\"log\": {\"version\": \"1.2\", \"creator\": %s, \"entries\": [\n", creator)
+		if err := c.buf.Flush(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Middleware records every request served by next
+func (c *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured := &Request{
+			Time:    time.Now(),
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Query:   r.URL.RawQuery,
+			Headers: make(map[string]string),
+		}
+		for name, values := range r.Header {
+			if !hopHeaders[name] && !c.skipHeaders[name] {
+				captured.Headers[name] = strings.Join(values, ", ")
+			}
+		}
+
+		// Read the body up to the limit and hand the handler all of it
+		if r.Body != nil && r.Body != http.NoBody {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+			if err == nil && len(body) > maxBody {
+				captured.BodyTruncated = true
+			} else if utf8.Valid(body) {
+				captured.Body = string(body)
+			} else {
+				captured.Body = base64.StdEncoding.EncodeToString(body)
+				captured.BodyBase64 = true
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		captured.Status = rec.status
+		captured.DurationMs = durationMs(time.Since(captured.Time))
+		c.record(captured, r)
+	})
+}
+
+// record writes a request to the capture, keeping the first error for Close
+func (c *Recorder) record(captured *Request, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+
+	var line []byte
+	var err error
+	if c.har {
+		line, err = json.Marshal(harEntry(captured, r))
+		if err == nil && c.entries > 0 {
+			line = append([]byte(",\n"), line...)
+		}
+		c.entries++
+	} else {
+		line, err = json.Marshal(captured)
+		line = append(line, '\n')
+	}
+	if err == nil {
+		_, err = c.buf.Write(line)
+	}
+	if err == nil {
+		err = c.buf.Flush()
+	}
+	c.err = err
+}
+
+// harEntry converts a captured request to a HAR entry
+func harEntry(captured *Request, r *http.Request) HAREntry {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: captured.Path, RawQuery: captured.Query}
+	entry := HAREntry{
+		StartedDateTime: captured.Time,
+		Time:            captured.DurationMs,
+		Request: HARRequest{
+			Method:      captured.Method,
+			URL:         u.String(),
+			HTTPVersion: r.Proto,
+			Headers:     harHeaders(captured.Headers),
+			QueryString: harQuery(captured.Query),
+			Cookies:     []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    r.ContentLength,
+		},
+		Response: HARResponse{
+			Status:      captured.Status,
+			StatusText:  http.StatusText(captured.Status),
+			HTTPVersion: r.Proto,
+			Headers:     []HARNameValue{},
+			Cookies:     []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: HARTimings{Send: 0, Wait: captured.DurationMs, Receive: 0},
+	}
+	if captured.Body != "" && !captured.BodyBase64 {
+		entry.Request.PostData = &HARPostData{MimeType: captured.Headers["Content-Type"], Text: captured.Body}
+	}
+	return entry
+}
+
+// Close ends the capture and closes the file. It returns the first error met
+// writing the capture, if any.
+func (c *Recorder) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		c.file.Close()
+		return c.err
+	}
+	if c.har {
+		c.buf.WriteString("\n]}}\n")
+	}
+	if err := c.buf.Flush(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
+
+// statusRecorder keeps the status code a handler responded with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush passes flushes on, so streamed responses are not held back
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Proxy forwards requests to target and records them with recorder
+func Proxy(target string, recorder *Recorder) (http.Handler, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("target %q is not an absolute url", target)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = u.Host
+	}
+	return recorder.Middleware(proxy), nil
+}
+
+// Load reads captured requests from a JSONL capture or a HAR file, sorted by
+// the time they arrived
+func Load(path string) ([]*Request, error) {
+	var captured []*Request
+	if strings.EqualFold(filepath.Ext(path), ".har") {
+		har, err := LoadHAR(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range har.Log.Entries {
+			c, err := requestFromHAR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			captured = append(captured, c)
+		}
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		decoder := json.NewDecoder(file)
+		for line := 1; ; line++ {
+			c := &Request{}
+			if err := decoder.Decode(c); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: request %d: %w", path, line, err)
+			}
+			captured = append(captured, c)
+		}
+	}
+	if len(captured) == 0 {
+		return nil, errors.New(path + ": no requests captured")
+	}
+	sort.SliceStable(captured, func(i, j int) bool { return captured[i].Time.Before(captured[j].Time) })
+	return captured, nil
+}
+
+// requestFromHAR converts a HAR entry to a captured request
+func requestFromHAR(entry HAREntry) (*Request, error) {
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	c := &Request{
+		Time:       entry.StartedDateTime,
+		Method:     entry.Request.Method,
+		Path:       u.Path,
+		Query:      u.RawQuery,
+		Headers:    make(map[string]string),
+		Status:     entry.Response.Status,
+		DurationMs: entry.Time,
+	}
+	for _, h := range entry.Request.Headers {
+		name := http.CanonicalHeaderKey(h.Name)
+		// HTTP/2 pseudo headers such as :authority are not real headers
+		if hopHeaders[name] || strings.HasPrefix(name, ":") || name == "Host" {
+			continue
+		}
+		c.Headers[name] = h.Value
+	}
+	if entry.Request.PostData != nil {
+		c.Body = entry.Request.PostData.Text
+		if _, ok := c.Headers["Content-Type"]; !ok && entry.Request.PostData.MimeType != "" {
+			c.Headers["Content-Type"] = entry.Request.PostData.MimeType
+		}
+	} else if entry.Request.BodySize > 0 {
+		// The request had a body that was not recorded, such as a binary one
+		c.BodyTruncated = true
+	}
+	return c, nil
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderRoundTrip(t *testing.T) {
+	for _, name := range []string{"capture.jsonl", "capture.har"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			recorder, err := NewRecorder(path, []string{"authorization"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := recorder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			}))
+			for _, body := range []string{`{"name":"a"}`, `{"name":"b"}`} {
+				r := httptest.NewRequest(http.MethodPost, "/book?x=1", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set("Authorization", "Bearer secret")
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}
+			if err := recorder.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			captured, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(captured) != 2 {
+				t.Fatalf("loaded %d requests, want 2", len(captured))
+			}
+			for i, c := range captured {
+				if c.Method != http.MethodPost || c.Path != "/book" || c.Query != "x=1" || c.Status != http.StatusCreated {
+					t.Errorf("request %d: %s %s?%s %d", i, c.Method, c.Path, c.Query, c.Status)
+				}
+				if _, ok := c.Headers["Authorization"]; ok {
+					t.Errorf("request %d: skipped header was recorded", i)
+				}
+			}
+			if captured[1].Body != `{"name":"b"}` {
+				t.Errorf("second body %q", captured[1].Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// HAR is an HTTP Archive (HAR 1.2) file, as saved by browsers and proxies.
+// Only the fields the load tester reads or writes are declared.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root object of a HAR file
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator names the tool that wrote a HAR file
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one request and its response
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"` // total time of the request in milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest is the request of an entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	Cookies     []HARNameValue `json:"cookies"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse is the response of an entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, query parameter or cookie
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body of a request
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent describes the body of a response
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// HARTimings splits the time of an entry into phases, in milliseconds; -1
+// marks a phase that does not apply
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// LoadHAR reads a HAR file
+func LoadHAR(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	har := &HAR{}
+	if err := json.Unmarshal(data, har); err != nil {
+		return nil, fmt.Errorf("parsing HAR %s: %w", path, err)
+	}
+	return har, nil
+}
+
+// harHeaders converts a header map to HAR name/value pairs
+func harHeaders(headers map[string]string) []HARNameValue {
+	pairs := make([]HARNameValue, 0, len(headers))
+	for name, value := range headers {
+		pairs = append(pairs, HARNameValue{Name: name, Value: value})
+	}
+	return pairs
+}
+
+// harQuery converts a raw query to HAR name/value pairs
+func harQuery(rawQuery string) []HARNameValue {
+	pairs := []HARNameValue{}
+	values, _ := url.ParseQuery(rawQuery)
+	for name, list := range values {
+		for _, value := range list {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
@@ -18,6 +18,8 @@ type Config struct {
 	REDIS_HOST string `mapstructure:"REDIS_HOST"`
 	REDIS_PORT string `mapstructure:"REDIS_PORT"`
 	REDIS_PASS string `mapstructure:"REDIS_PASS"`
+	// JSONL (or .har) file to record the served requests to, for replay by load_test
+	RECORD_FILE string `mapstructure:"RECORD_FILE"`
 }
 
 func InitConfig() *Config {
@@ -27,6 +29,8 @@ func InitConfig() *Config {
 	viper.SetConfigName("app")
 	viper.SetConfigType("env")
 	viper.AutomaticEnv()
+	// Optional, so it may be missing from app.env
+	viper.BindEnv("RECORD_FILE")
 
 	if err := viper.ReadInConfig(); err != nil {
 		log.Fatal("Error reading env file", err)
@@ -1,16 +1,23 @@
 package container
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/Bappy60/BookStore_in_Go/pkg/capture"
 	"github.com/Bappy60/BookStore_in_Go/pkg/config"
 	"github.com/Bappy60/BookStore_in_Go/pkg/connection"
 	"github.com/Bappy60/BookStore_in_Go/pkg/controllers"
+	"github.com/Bappy60/BookStore_in_Go/pkg/domain"
 	"github.com/Bappy60/BookStore_in_Go/pkg/repositories"
 	"github.com/Bappy60/BookStore_in_Go/pkg/routes"
 	"github.com/Bappy60/BookStore_in_Go/pkg/services"
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 )
 
 func Serve() {
@@ -19,14 +26,62 @@ func Serve() {
 	redisClient := connection.Redis()
 
 	bookRepo := repositories.BookDBInstance(db)
+	authorRepo := repositories.AuthorDBInstance(db)
+
+	log.Println("Database Connected...")
+	var handler http.Handler = Router(bookRepo, authorRepo, redisClient)
+
+	// Record the served requests for replay by load_test
+	var recorder *capture.Recorder
+	if path := config.GConfig.RECORD_FILE; path != "" {
+		var err error
+		if recorder, err = capture.NewRecorder(path, nil); err != nil {
+			log.Fatal("Error creating capture file ", err)
+		}
+		handler = recorder.Middleware(handler)
+		log.Println("Recording requests to", path)
+	}
+	server := &http.Server{Addr: ":9011", Handler: handler}
+
+	// Stop on Ctrl-C, letting the requests in flight finish first
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		server.Shutdown(context.Background())
+	}()
+
+	// HTTP Server
+	log.Println("Server Started...")
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	log.Println("Server Stopped...")
+
+	// Write out the capture, then release the connections
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			log.Fatal("Error writing capture file ", err)
+		}
+	}
+	if err := redisClient.Close(); err != nil {
+		log.Println("Error closing redis connection", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Fatal("Error closing database connection ", err)
+	}
+}
+
+// Router builds the bookstore's routes on top of the given repos, so tests
+// can serve it with in-memory repos and without redis
+func Router(bookRepo domain.IBookRepo, authorRepo domain.IAuthorRepo, redisClient *redis.Client) *mux.Router {
 	bookService := services.BookServiceInstance(bookRepo, redisClient)
 	bookController := controllers.BookControllerInstance(bookService)
 
-	authorRepo := repositories.AuthorDBInstance(db)
 	authorService := services.AuthorServiceInstance(authorRepo)
 	authorController := controllers.AuthorControllerInstance(authorService)
 
-	log.Println("Database Connected...")
 	r := mux.NewRouter()
 
 	services.PopulateBookCacheMap(bookRepo)
@@ -39,8 +94,5 @@ func Serve() {
 	// Registering Routes
 	routes.AuthorRoutes(r, authorController)
 	routes.BookRoutes(r, bookController)
-
-	// HTTP Server
-	log.Println("Server Started...")
-	log.Fatal(http.ListenAndServe(":9011", r))
+	return r
 }
@@ -0,0 +1,41 @@
+package container
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/loadgen/loadtest"
+	"github.com/Bappy60/BookStore_in_Go/pkg/repositories"
+	"github.com/Bappy60/BookStore_in_Go/pkg/types"
+)
+
+// TestRouterLoad runs testdata/load.yaml against the bookstore with in-memory
+// repos and without redis
+func TestRouterLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test skipped in short mode")
+	}
+	store := repositories.NewMemoryStore()
+	bookRepo := repositories.BookMemoryInstance(store)
+	authorRepo := repositories.AuthorMemoryInstance(store)
+	for i := 1; i <= 5; i++ {
+		author, err := authorRepo.CreateAuthor(&types.CreateAuthorStruc{Name: "Test Author", Email: fmt.Sprintf("author%d@example.com", i), Age: 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = bookRepo.CreateBook(&types.CreateBookStruc{Name: fmt.Sprintf("Test Book %d", i), PublicationYear: 2000, NumberOfPages: 300, AuthorID: author.ID, Publication: "Test Press"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The thresholds leave room for slow or busy CI machines, and for -race:
+	// they catch a handler that stalls or falls far behind, not small slowdowns
+	loadtest.Run(t, Router(bookRepo, authorRepo, nil), loadtest.Test{
+		ScenarioFile: "testdata/load.yaml",
+		Rate:         200,
+		Duration:     2 * time.Second,
+		Thresholds:   []string{"p95 < 250ms", "rps_achieved > 0.8*target"},
+	})
+}
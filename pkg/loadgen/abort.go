@@ -0,0 +1,95 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Aborter stops a run early, on an interrupt or once the results so far meet
+// one of its conditions. Conditions use the threshold syntax, but abort the
+// run when they hold, e.g. "error_rate > 50%"; they are checked at the end of
+// every interval against the results since the start of the run.
+type Aborter struct {
+	mu         sync.Mutex
+	cancel     context.CancelCauseFunc
+	conditions []*Threshold
+	metrics    *Metrics // results since the start of the run
+	reason     string   // why the run was aborted, "" while it runs
+}
+
+// NewAborter creates an aborter that cancels the run with cancel, giving the
+// reason as the cause. A positive maxErrors aborts the run once that many
+// requests have returned an error or a 5xx status.
+func NewAborter(cancel context.CancelCauseFunc, maxErrors int, conditions []string) (*Aborter, error) {
+	a := &Aborter{cancel: cancel, metrics: newLeafMetrics()}
+	for _, expr := range conditions {
+		t, err := ParseThreshold(expr)
+		if err != nil {
+			return nil, err
+		}
+		a.conditions = append(a.conditions, t)
+	}
+	if maxErrors > 0 {
+		raw := fmt.Sprintf("errors >= %d", maxErrors)
+		a.conditions = append(a.conditions, &Threshold{Raw: raw, Metric: "errors", Op: ">=", Value: float64(maxErrors)})
+	}
+	return a, nil
+}
+
+// Enabled reports whether the aborter has conditions to check
+func (a *Aborter) Enabled() bool {
+	return len(a.conditions) > 0
+}
+
+// Abort stops the run; only the first reason is kept
+func (a *Aborter) Abort(reason string) {
+	a.mu.Lock()
+	if a.reason == "" {
+		a.reason = reason
+	}
+	a.mu.Unlock()
+	a.cancel(errors.New(reason))
+}
+
+// Reason returns why the run was aborted, or "" if it was not
+func (a *Aborter) Reason() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reason
+}
+
+// OnInterval adds the results of a window and checks the conditions
+func (a *Aborter) OnInterval(w *Window) {
+	a.mu.Lock()
+	a.metrics.Merge(w.Metrics)
+	group := newGroupSummary("run", a.metrics, w.Elapsed.Seconds())
+	a.mu.Unlock()
+
+	if w.Last {
+		return
+	}
+	for _, t := range a.conditions {
+		if actual, met := t.Evaluate(group); met {
+			a.Abort(fmt.Sprintf("%s (actual %s)", t.Raw, actual))
+			return
+		}
+	}
+}
+
+// sleepContext sleeps for d, returning false early if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,493 @@
+package loadgen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// agentStartDelay is how long the coordinator gives its agents to receive
+// their job before they all start firing requests
+const agentStartDelay = 2 * time.Second
+
+// AgentTokenEnv is the environment variable the shared token of agents and
+// their coordinator is read from, when it is not given with -agent-token
+const AgentTokenEnv = "LOADGEN_AGENT_TOKEN"
+
+// AgentJob is the share of a run that the coordinator hands to one agent.
+// Agents load the scenario file themselves, so it and its feeder files must
+// exist at the same path on every agent.
+type AgentJob struct {
+	URL          string        `json:"url"`                // url to make requests to, or the scenario base url
+	ScenarioFile string        `json:"scenario,omitempty"` // YAML or JSON scenario file
+	Stages       []Stage       `json:"stages"`             // the agent's share of the load profile
+	MaxInFlight  int           `json:"max_inflight"`       // cap on concurrent requests of the agent
+	Interval     time.Duration `json:"interval"`           // length of the windows streamed back
+	StartAt      time.Time     `json:"start_at"`           // when the agent starts firing, so the clocks of the agents must be in sync
+
+	Transport TransportConfig `json:"transport"` // options of the HTTP client, certificate files included by path
+}
+
+// AgentWindow is one interval of results streamed from an agent
+type AgentWindow struct {
+	Start    time.Time     `json:"start"`
+	Elapsed  time.Duration `json:"elapsed"`
+	Length   time.Duration `json:"length"`
+	Metrics  *Metrics      `json:"metrics"`
+	InFlight int           `json:"in_flight"`
+	Sent     int64         `json:"sent"`
+	Dropped  int64         `json:"dropped"`
+	Last     bool          `json:"last,omitempty"` // the agent's final window
+}
+
+// AgentResult is the final result of an agent's share of the run
+type AgentResult struct {
+	Metrics  *Metrics       `json:"metrics"`
+	Stats    SchedulerStats `json:"stats"`
+	Start    time.Time      `json:"start"`
+	Duration time.Duration  `json:"duration"`
+}
+
+// AgentMessage is one line of the stream an agent sends back for a job;
+// exactly one of the fields is set
+type AgentMessage struct {
+	Window *AgentWindow `json:"window,omitempty"`
+	Result *AgentResult `json:"result,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// Agent runs jobs handed out by a coordinator, one at a time
+type Agent struct {
+	token string     // shared token the coordinator sends as a bearer token
+	mu    sync.Mutex // held while a job is running
+
+	stopMu sync.Mutex
+	stop   context.CancelFunc // stops the running job, nil between jobs
+}
+
+// ServeAgent listens on addr and runs the jobs posted to /run by a
+// coordinator that sends token. An addr without a host, such as ":7070",
+// listens on localhost only.
+func ServeAgent(addr, token string) error {
+	if token == "" {
+		return fmt.Errorf("agents need a shared token, set with -agent-token or %s", AgentTokenEnv)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+
+	agent := &Agent{token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", agent.authorize(agent.handleRun))
+	mux.HandleFunc("/stop", agent.authorize(agent.handleStop))
+	fmt.Println("Agent listening on", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// authorize rejects the requests that do not carry the agent's token
+func (a *Agent) authorize(handler http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + a.token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "invalid agent token", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleRun runs a job and streams its windows and final result back as JSON lines
+func (a *Agent) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.mu.TryLock() {
+		http.Error(w, "agent is already running a job", http.StatusConflict)
+		return
+	}
+	defer a.mu.Unlock()
+
+	var job AgentJob
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		http.Error(w, "invalid job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	scenario, profile, err := job.prepare()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := job.Transport.NewClient()
+	if err != nil {
+		http.Error(w, "invalid transport: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The job stops early when the coordinator asks for it or goes away
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	a.stopMu.Lock()
+	a.stop = cancel
+	a.stopMu.Unlock()
+	defer func() {
+		a.stopMu.Lock()
+		a.stop = nil
+		a.stopMu.Unlock()
+	}()
+
+	stream := newAgentStream(w)
+	stream.flush()
+	sleepContext(ctx, time.Until(job.StartAt))
+
+	fmt.Printf("Running job: %s, %d stages, max in-flight %d\n", job.URL, len(job.Stages), job.MaxInFlight)
+	scheduler := NewArrivalScheduler(profile, job.MaxInFlight)
+	live := NewIntervalRecorder()
+	metrics, runStart, runDuration := runWorkers(ctx, scenario, NewHTTPTarget(client), scheduler, job.MaxInFlight, []ResultSink{live}, live, job.Interval, []IntervalListener{stream})
+	stream.send(&AgentMessage{Result: &AgentResult{
+		Metrics:  metrics,
+		Stats:    scheduler.Stats(),
+		Start:    runStart,
+		Duration: runDuration,
+	}})
+	fmt.Println("Job finished:", metrics.Requests, "requests")
+}
+
+// handleStop stops the running job, which then streams back its result as usual
+func (a *Agent) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.stopMu.Lock()
+	defer a.stopMu.Unlock()
+	if a.stop == nil {
+		http.Error(w, "no job running", http.StatusConflict)
+		return
+	}
+	a.stop()
+}
+
+// prepare loads the scenario and the load profile of a job
+func (job *AgentJob) prepare() (*Scenario, *Profile, error) {
+	scenario := SingleURLScenario(job.URL)
+	if job.ScenarioFile != "" {
+		var err error
+		if scenario, err = LoadScenario(job.ScenarioFile); err != nil {
+			return nil, nil, fmt.Errorf("loading scenario: %w", err)
+		}
+	}
+	if err := scenario.Prepare(job.URL); err != nil {
+		return nil, nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := scenario.checkOpenLoop(); err != nil {
+		return nil, nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if job.MaxInFlight < 1 {
+		return nil, nil, errors.New("max in-flight must be positive")
+	}
+	if job.Interval <= 0 {
+		return nil, nil, errors.New("interval must be positive")
+	}
+	profile := &Profile{Stages: job.Stages}
+	if err := profile.Prepare(); err != nil {
+		return nil, nil, fmt.Errorf("invalid load profile: %w", err)
+	}
+	return scenario, profile, nil
+}
+
+// agentStream writes JSON lines to the coordinator, flushing after each one
+type agentStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	encoder *json.Encoder
+}
+
+// newAgentStream starts a JSON lines response
+func newAgentStream(w http.ResponseWriter) *agentStream {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	return &agentStream{w: w, encoder: json.NewEncoder(w)}
+}
+
+// OnInterval streams a window of live results
+func (s *agentStream) OnInterval(w *Window) {
+	s.send(&AgentMessage{Window: &AgentWindow{
+		Start:    w.Start,
+		Elapsed:  w.Elapsed,
+		Length:   w.Length,
+		Metrics:  w.Metrics,
+		InFlight: w.InFlight,
+		Sent:     w.Sent,
+		Dropped:  w.Dropped,
+		Last:     w.Last,
+	}})
+}
+
+// send writes one message; errors are ignored as the coordinator notices a
+// broken stream itself
+func (s *agentStream) send(msg *AgentMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.encoder.Encode(msg)
+	s.flushLocked()
+}
+
+// flush sends any buffered output to the coordinator
+func (s *agentStream) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+func (s *agentStream) flushLocked() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// runDistributed splits the profile evenly across the agents of the run,
+// starts them together and merges the windows and results they stream back.
+// The agents' tick counters are added to scheduler.
+func runDistributed(ctx context.Context, cfg *RunConfig, profile *Profile, scheduler *ArrivalScheduler, listeners []IntervalListener) (*Metrics, time.Time, time.Duration, error) {
+	if cfg.AgentToken == "" {
+		return nil, time.Time{}, 0, fmt.Errorf("agents need a shared token, set with -agent-token or %s", AgentTokenEnv)
+	}
+	agents := len(cfg.Agents)
+	share := make([]Stage, len(profile.Stages))
+	for i, stage := range profile.Stages {
+		share[i] = Stage{
+			Name:     stage.Name,
+			Duration: stage.Duration,
+			From:     stage.From / float64(agents),
+			To:       stage.To / float64(agents),
+		}
+	}
+	job := AgentJob{
+		URL:          cfg.URL,
+		ScenarioFile: cfg.ScenarioFile,
+		Stages:       share,
+		MaxInFlight:  int(math.Ceil(float64(cfg.MaxInFlight) / float64(agents))),
+		Interval:     cfg.Interval,
+		StartAt:      time.Now().Add(agentStartDelay),
+		Transport:    cfg.Transport,
+	}
+
+	merger := newWindowMerger(profile, agents, listeners)
+	results := make([]*AgentResult, agents)
+	errs := make([]error, agents)
+
+	// Post all jobs together, each starting at the same moment
+	wg := &sync.WaitGroup{}
+	wg.Add(agents)
+	for i, addr := range cfg.Agents {
+		go func(i int, addr string) {
+			defer wg.Done()
+			defer merger.finish(i)
+			results[i], errs[i] = runAgent(addr, cfg.AgentToken, &job, func(w *AgentWindow) { merger.add(i, w) })
+		}(i, addr)
+	}
+	// Ask the agents to stop early if the run is cancelled
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			for _, addr := range cfg.Agents {
+				stopAgent(addr, cfg.AgentToken)
+			}
+		case <-finished:
+		}
+	}()
+	wg.Wait()
+	close(finished)
+
+	metrics := NewMetrics()
+	var runStart time.Time
+	var runDuration time.Duration
+	for i, result := range results {
+		if errs[i] != nil {
+			return nil, time.Time{}, 0, fmt.Errorf("agent %s: %w", cfg.Agents[i], errs[i])
+		}
+		metrics.Merge(result.Metrics)
+		scheduler.AddStats(result.Stats)
+		if runStart.IsZero() || result.Start.Before(runStart) {
+			runStart = result.Start
+		}
+		if result.Duration > runDuration {
+			runDuration = result.Duration
+		}
+	}
+	return metrics, runStart, runDuration, nil
+}
+
+// runAgent posts a job to the agent at addr and reads the stream it sends
+// back, handing every window to onWindow
+func runAgent(addr, token string, job *AgentJob, onWindow func(*AgentWindow)) (*AgentResult, error) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postAgent(addr, "/run", token, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(msg))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg AgentMessage
+		if err := decoder.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("reading results: %w", err)
+		}
+		switch {
+		case msg.Error != "":
+			return nil, errors.New(msg.Error)
+		case msg.Window != nil:
+			onWindow(msg.Window)
+		case msg.Result != nil:
+			return msg.Result, nil
+		}
+	}
+}
+
+// stopAgent asks the agent at addr to stop its job; errors are ignored, as
+// the job's stream reports how the agent ended
+func stopAgent(addr, token string) {
+	resp, err := postAgent(addr, "/stop", token, "text/plain", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// postAgent posts body to path on the agent at addr with the shared token
+func postAgent(addr, path, token, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, agentURL(addr, path), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(req)
+}
+
+// agentURL returns the url of path on the agent at addr, which may omit the scheme
+func agentURL(addr, path string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/") + path
+}
+
+// windowMerger combines the windows streamed by the agents into one window
+// per interval. Agents start together, so their n-th windows cover the same
+// interval; a merged window is handed to the listeners once every agent has
+// sent it, sent its final window or finished. The merged window is final once
+// no agent has windows left to send.
+type windowMerger struct {
+	mu        sync.Mutex
+	profile   *Profile
+	listeners []IntervalListener
+	received  []int           // windows received per agent
+	ended     []bool          // agents that sent their final window
+	finished  []bool          // agents whose stream has ended
+	pending   map[int]*Window // merged windows not yet handed out, by index
+	next      int             // index of the next window to hand out
+}
+
+// newWindowMerger creates a merger for the given number of agents
+func newWindowMerger(profile *Profile, agents int, listeners []IntervalListener) *windowMerger {
+	return &windowMerger{
+		profile:   profile,
+		listeners: listeners,
+		received:  make([]int, agents),
+		ended:     make([]bool, agents),
+		finished:  make([]bool, agents),
+		pending:   make(map[int]*Window),
+	}
+}
+
+// add merges a window received from an agent
+func (m *windowMerger) add(agent int, aw *AgentWindow) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := m.received[agent]
+	m.received[agent]++
+	w, ok := m.pending[index]
+	if !ok {
+		w = &Window{Start: aw.Start, Metrics: NewMetrics()}
+		m.pending[index] = w
+	}
+	if aw.Start.Before(w.Start) {
+		w.Start = aw.Start
+	}
+	if aw.Elapsed > w.Elapsed {
+		w.Elapsed = aw.Elapsed
+	}
+	if aw.Length > w.Length {
+		w.Length = aw.Length
+	}
+	w.Metrics.Merge(aw.Metrics)
+	w.InFlight += aw.InFlight
+	w.Sent += aw.Sent
+	w.Dropped += aw.Dropped
+	if aw.Last {
+		m.ended[agent] = true
+	}
+	m.emitReady()
+}
+
+// finish marks the stream of an agent as ended
+func (m *windowMerger) finish(agent int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished[agent] = true
+	m.emitReady()
+}
+
+// emitReady hands out the merged windows that every agent has sent or ended
+// before
+func (m *windowMerger) emitReady() {
+	for {
+		w, ok := m.pending[m.next]
+		if !ok {
+			return
+		}
+		allEnded := true
+		for agent, received := range m.received {
+			ended := m.ended[agent] || m.finished[agent]
+			if received <= m.next && !ended {
+				return
+			}
+			if !ended || received > m.next+1 {
+				allEnded = false
+			}
+		}
+		delete(m.pending, m.next)
+		m.next++
+
+		w.Stage = m.profile.StageAt(w.Elapsed)
+		w.Last = allEnded
+		for _, listener := range m.listeners {
+			listener.OnInterval(w)
+		}
+	}
+}
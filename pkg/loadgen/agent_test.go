@@ -0,0 +1,117 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeAgent serves /run like an agent, streaming back the given number of
+// windows of one request each, the last one flagged as final, and a result
+func fakeAgent(t *testing.T, token string, windows int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "invalid agent token", http.StatusUnauthorized)
+			return
+		}
+		var job AgentJob
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			t.Errorf("decoding job: %v", err)
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		start := time.Now()
+		total := NewMetrics()
+		for i := 0; i < windows; i++ {
+			m := NewMetrics()
+			m.Record(Result{Name: "GET /", Status: 200, Latency: time.Millisecond})
+			total.Merge(m)
+			encoder.Encode(&AgentMessage{Window: &AgentWindow{
+				Start:   start.Add(time.Duration(i) * time.Second),
+				Elapsed: time.Duration(i+1) * time.Second,
+				Length:  time.Second,
+				Metrics: m,
+				Sent:    1,
+				Last:    i == windows-1,
+			}})
+		}
+		encoder.Encode(&AgentMessage{Result: &AgentResult{
+			Metrics:  total,
+			Stats:    SchedulerStats{Sent: int64(windows), StageSent: []int64{int64(windows)}, StageDropped: []int64{0}},
+			Start:    start,
+			Duration: time.Duration(windows) * time.Second,
+		}})
+	}))
+}
+
+// windowCollector keeps a copy of every window it is handed
+type windowCollector struct {
+	windows []Window
+}
+
+func (c *windowCollector) OnInterval(w *Window) {
+	c.windows = append(c.windows, *w)
+}
+
+func TestRunDistributedMergesWindows(t *testing.T) {
+	a := fakeAgent(t, "secret", 3)
+	defer a.Close()
+	b := fakeAgent(t, "secret", 2)
+	defer b.Close()
+
+	profile := ConstantProfile(2, 3*time.Second)
+	if err := profile.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewRunConfig()
+	cfg.Agents = []string{a.URL, b.URL}
+	cfg.AgentToken = "secret"
+	collector := &windowCollector{}
+	scheduler := NewArrivalScheduler(profile, cfg.MaxInFlight)
+
+	metrics, _, _, err := runDistributed(context.Background(), cfg, profile, scheduler, []IntervalListener{collector})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Requests != 5 {
+		t.Errorf("merged %d requests, want 5", metrics.Requests)
+	}
+	if sent := scheduler.Stats().Sent; sent != 5 {
+		t.Errorf("merged %d sent ticks, want 5", sent)
+	}
+
+	want := []struct {
+		requests int
+		last     bool
+	}{{2, false}, {2, false}, {1, true}}
+	if len(collector.windows) != len(want) {
+		t.Fatalf("got %d windows, want %d", len(collector.windows), len(want))
+	}
+	for i, w := range want {
+		got := collector.windows[i]
+		if got.Metrics.Requests != w.requests || got.Last != w.last {
+			t.Errorf("window %d: %d requests, last %v; want %d requests, last %v", i, got.Metrics.Requests, got.Last, w.requests, w.last)
+		}
+	}
+}
+
+func TestRunDistributedRejectsWrongToken(t *testing.T) {
+	a := fakeAgent(t, "secret", 1)
+	defer a.Close()
+
+	profile := ConstantProfile(1, time.Second)
+	if err := profile.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewRunConfig()
+	cfg.Agents = []string{a.URL}
+	cfg.AgentToken = "wrong"
+	_, _, _, err := runDistributed(context.Background(), cfg, profile, NewArrivalScheduler(profile, cfg.MaxInFlight), nil)
+	if err == nil {
+		t.Fatal("run with a wrong token succeeded")
+	}
+}
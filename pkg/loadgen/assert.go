@@ -0,0 +1,230 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Assertions are checks on the response of a request. A request whose
+// response fails any of them is counted as an assertion failure, separately
+// from errors.
+type Assertions struct {
+	Status       []int       `yaml:"status,omitempty" json:"status"`               // allowed status codes
+	Headers      []string    `yaml:"headers,omitempty" json:"headers"`             // headers that must be present
+	MaxSize      int64       `yaml:"max_size,omitempty" json:"max_size"`           // largest allowed body, in bytes
+	BodyContains []string    `yaml:"body_contains,omitempty" json:"body_contains"` // substrings the body must contain
+	BodyMatches  []string    `yaml:"body_matches,omitempty" json:"body_matches"`   // regular expressions the body must match
+	JSON         []JSONCheck `yaml:"json,omitempty" json:"json"`                   // checks on the body parsed as JSON
+
+	patterns []*regexp.Regexp // compiled BodyMatches
+}
+
+// JSONCheck checks the value at a JSON path such as "$[0].name" or
+// "$.books[2]['author_id']". Without Equals, the value must exist (or, with
+// exists: false, must not).
+type JSONCheck struct {
+	Path   string      `yaml:"path" json:"path"`
+	Exists *bool       `yaml:"exists" json:"exists"`
+	Equals interface{} `yaml:"equals" json:"equals"`
+
+	steps []jsonPathStep // parsed Path
+}
+
+// jsonPathStep is one object key or array index of a JSON path
+type jsonPathStep struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// Prepare validates the assertions and compiles their patterns and paths
+func (a *Assertions) Prepare() error {
+	a.patterns = a.patterns[:0]
+	for _, expr := range a.BodyMatches {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("body_matches %q: %w", expr, err)
+		}
+		a.patterns = append(a.patterns, re)
+	}
+	for i := range a.JSON {
+		check := &a.JSON[i]
+		steps, err := parseJSONPath(check.Path)
+		if err != nil {
+			return err
+		}
+		check.steps = steps
+		if check.Exists != nil && !*check.Exists && check.Equals != nil {
+			return fmt.Errorf("json path %q: equals cannot be combined with exists: false", check.Path)
+		}
+	}
+	return nil
+}
+
+// NeedsBody reports whether checking the assertions requires the response body
+func (a *Assertions) NeedsBody() bool {
+	return len(a.BodyContains) > 0 || len(a.BodyMatches) > 0 || len(a.JSON) > 0
+}
+
+// Check returns a message for every assertion the response fails. The
+// messages do not contain the body, so failures of the same kind are counted
+// together. body is only read if NeedsBody is true, while size is always the
+// length of the body.
+func (a *Assertions) Check(resp *http.Response, body []byte, size int64) []string {
+	var failures []string
+	if len(a.Status) > 0 {
+		allowed := false
+		for _, status := range a.Status {
+			if resp.StatusCode == status {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			failures = append(failures, fmt.Sprintf("status %d, want %v", resp.StatusCode, a.Status))
+		}
+	}
+	for _, header := range a.Headers {
+		if resp.Header.Get(header) == "" {
+			failures = append(failures, fmt.Sprintf("missing header %s", header))
+		}
+	}
+	if a.MaxSize > 0 && size > a.MaxSize {
+		failures = append(failures, fmt.Sprintf("body larger than %d bytes", a.MaxSize))
+	}
+	for _, s := range a.BodyContains {
+		if !bytes.Contains(body, []byte(s)) {
+			failures = append(failures, fmt.Sprintf("body does not contain %q", s))
+		}
+	}
+	for _, re := range a.patterns {
+		if !re.Match(body) {
+			failures = append(failures, fmt.Sprintf("body does not match %q", re))
+		}
+	}
+
+	if len(a.JSON) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return append(failures, "body is not valid JSON")
+		}
+		for _, check := range a.JSON {
+			if msg := check.check(doc); msg != "" {
+				failures = append(failures, msg)
+			}
+		}
+	}
+	return failures
+}
+
+// check returns a failure message, or "" if the check passes
+func (c *JSONCheck) check(doc interface{}) string {
+	value, found := lookupJSONPath(doc, c.steps)
+	wantExists := c.Exists == nil || *c.Exists
+	switch {
+	case !wantExists && found:
+		return fmt.Sprintf("json %s exists", c.Path)
+	case !wantExists:
+		return ""
+	case !found:
+		return fmt.Sprintf("json %s missing", c.Path)
+	case c.Equals != nil && !jsonEqual(value, c.Equals):
+		return fmt.Sprintf("json %s not equal to %v", c.Path, c.Equals)
+	}
+	return ""
+}
+
+// parseJSONPath parses the subset of JSONPath made of $, .key, [n] and ['key']
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("json path %q: must start with $", path)
+	}
+
+	var steps []jsonPathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("json path %q: empty key", path)
+			}
+			steps = append(steps, jsonPathStep{key: key, isKey: true})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %q: missing ]", path)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1], isKey: true})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("json path %q: invalid index %q", path, inner)
+				}
+				steps = append(steps, jsonPathStep{index: index})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("json path %q: unexpected %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSONPath returns the value at the path in a decoded JSON document.
+// Negative indexes count from the end of an array.
+func lookupJSONPath(doc interface{}, steps []jsonPathStep) (interface{}, bool) {
+	value := doc
+	for _, step := range steps {
+		if step.isKey {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[step.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		index := step.index
+		if index < 0 {
+			index += len(array)
+		}
+		if index < 0 || index >= len(array) {
+			return nil, false
+		}
+		value = array[index]
+	}
+	return value, true
+}
+
+// jsonEqual compares a decoded JSON value with a value from the scenario
+// file, which may have been decoded from YAML with different number types
+func jsonEqual(actual, expected interface{}) bool {
+	encoded, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(actual, normalized)
+}
@@ -0,0 +1,175 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Comparison is the difference between a run and a baseline run, read from
+// the summary.json the baseline wrote
+type Comparison struct {
+	Baseline         string           `json:"baseline"`               // path of the baseline summary
+	TolerancePercent float64          `json:"tolerance_percent"`      // allowed relative change of throughput and latency
+	ErrorTolerance   float64          `json:"error_tolerance_points"` // allowed rise of the error rate, in percentage points
+	Rows             []*ComparisonRow `json:"rows"`                   // one row per scope and metric
+	Unmatched        []string         `json:"unmatched,omitempty"`    // endpoints found in only one of the runs
+	Regressions      int              `json:"regressions"`            // rows flagged as regressions
+}
+
+// ComparisonRow compares one metric of the whole run or of an endpoint
+type ComparisonRow struct {
+	Scope         string  `json:"scope"`          // "total" or an endpoint name
+	Metric        string  `json:"metric"`         // rps, p50, p95, p99 or error_rate
+	Baseline      float64 `json:"baseline"`       // value in the baseline run
+	Current       float64 `json:"current"`        // value in this run
+	ChangePercent float64 `json:"change_percent"` // relative change, 0 if the baseline is 0
+	Regression    bool    `json:"regression"`     // the change is worse than the tolerance
+}
+
+// LoadSummary reads the summary.json written by an earlier run
+func LoadSummary(path string) (*Summary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	summary := &Summary{}
+	if err := json.Unmarshal(data, summary); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return summary, nil
+}
+
+// Compare compares a run with its baseline. Throughput and latency regress
+// when they get worse by more than tolerance percent, the error rate when it
+// rises by more than errorTolerance percentage points.
+func Compare(baselinePath string, baseline, current *Summary, tolerance, errorTolerance float64) *Comparison {
+	c := &Comparison{
+		Baseline:         baselinePath,
+		TolerancePercent: tolerance,
+		ErrorTolerance:   errorTolerance,
+	}
+	c.addGroup("total", &GroupSummary{
+		ErrorRatePercent: baseline.Totals.ErrorRatePercent,
+		RPS:              baseline.Totals.AchievedRPS,
+		Latency:          baseline.Latency,
+	}, &GroupSummary{
+		ErrorRatePercent: current.Totals.ErrorRatePercent,
+		RPS:              current.Totals.AchievedRPS,
+		Latency:          current.Latency,
+	})
+
+	for _, group := range current.SortedEndpoints() {
+		if base, ok := baseline.Endpoints[group.Name]; ok {
+			c.addGroup(group.Name, base, group)
+		} else {
+			c.Unmatched = append(c.Unmatched, group.Name)
+		}
+	}
+	for _, base := range baseline.SortedEndpoints() {
+		if _, ok := current.Endpoints[base.Name]; !ok {
+			c.Unmatched = append(c.Unmatched, base.Name)
+		}
+	}
+	return c
+}
+
+// addGroup adds the rows comparing one scope
+func (c *Comparison) addGroup(scope string, baseline, current *GroupSummary) {
+	c.add(scope, "rps", baseline.RPS, current.RPS, -1)
+	c.add(scope, "p50", baseline.Latency.P50Ms, current.Latency.P50Ms, 1)
+	c.add(scope, "p95", baseline.Latency.P95Ms, current.Latency.P95Ms, 1)
+	c.add(scope, "p99", baseline.Latency.P99Ms, current.Latency.P99Ms, 1)
+
+	row := &ComparisonRow{
+		Scope:      scope,
+		Metric:     "error_rate",
+		Baseline:   baseline.ErrorRatePercent,
+		Current:    current.ErrorRatePercent,
+		Regression: current.ErrorRatePercent-baseline.ErrorRatePercent > c.ErrorTolerance,
+	}
+	if baseline.ErrorRatePercent > 0 {
+		row.ChangePercent = (current.ErrorRatePercent - baseline.ErrorRatePercent) / baseline.ErrorRatePercent * 100
+	}
+	c.addRow(row)
+}
+
+// add adds a row for a metric that gets worse in the direction of worse:
+// 1 if higher is worse, -1 if lower is worse
+func (c *Comparison) add(scope, metric string, baseline, current float64, worse float64) {
+	row := &ComparisonRow{Scope: scope, Metric: metric, Baseline: baseline, Current: current}
+	if baseline > 0 {
+		row.ChangePercent = (current - baseline) / baseline * 100
+		row.Regression = row.ChangePercent*worse > c.TolerancePercent
+	}
+	c.addRow(row)
+}
+
+// addRow appends a row, counting it if it is a regression
+func (c *Comparison) addRow(row *ComparisonRow) {
+	c.Rows = append(c.Rows, row)
+	if row.Regression {
+		c.Regressions++
+	}
+}
+
+// Checks converts the comparison into JUnit checks
+func (c *Comparison) Checks() []Check {
+	checks := make([]Check, 0, len(c.Rows))
+	for _, row := range c.Rows {
+		checks = append(checks, Check{
+			Name:    row.Metric,
+			Group:   "baseline." + row.Scope,
+			Passed:  !row.Regression,
+			Message: fmt.Sprintf("%s %s: baseline %s, actual %s (%s)", row.Scope, row.Metric, row.format(row.Baseline), row.format(row.Current), row.change()),
+		})
+	}
+	return checks
+}
+
+// format formats a value of the row's metric
+func (row *ComparisonRow) format(value float64) string {
+	switch row.Metric {
+	case "rps":
+		return fmt.Sprintf("%.2f/s", value)
+	case "error_rate":
+		return fmt.Sprintf("%.2f%%", value)
+	}
+	return fmt.Sprintf("%.2fms", value)
+}
+
+// change formats the change of the row; error rates change in points
+func (row *ComparisonRow) change() string {
+	if row.Metric == "error_rate" {
+		return fmt.Sprintf("%+.2f pts", row.Current-row.Baseline)
+	}
+	if row.Baseline == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f %%", row.ChangePercent)
+}
+
+// PrintComparison prints the diff table and reports whether there was no regression
+func PrintComparison(c *Comparison) bool {
+	width := len("Scope") + 2
+	for _, row := range c.Rows {
+		if len(row.Scope)+2 > width {
+			width = len(row.Scope) + 2
+		}
+	}
+
+	fmt.Printf("Baseline: %s (tolerance %.1f %%, error rate %.2f pts)\n", c.Baseline, c.TolerancePercent, c.ErrorTolerance)
+	fmt.Printf("%-*s%-12s%-14s%-14s%-14s%s\n", width, "Scope", "Metric", "Baseline", "Current", "Change", "Result")
+	for _, row := range c.Rows {
+		verdict := "ok"
+		if row.Regression {
+			verdict = "REGRESSION"
+		}
+		fmt.Printf("%-*s%-12s%-14s%-14s%-14s%s\n", width, row.Scope, row.Metric, row.format(row.Baseline), row.format(row.Current), row.change(), verdict)
+	}
+	if len(c.Unmatched) > 0 {
+		fmt.Println("Endpoints in only one run:", strings.Join(c.Unmatched, ", "))
+	}
+	return c.Regressions == 0
+}
@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"errors"
+	"time"
+)
+
+// RunConfig holds the options of a run
+type RunConfig struct {
+	URL          string `json:"url"`                  // url to make requests to, or the scenario base url
+	ScenarioFile string `json:"scenario,omitempty"`   // YAML or JSON scenario file
+	Rate         int    `json:"rps"`                  // requests per second without stages
+	Duration     int    `json:"duration_seconds"`     // duration in seconds without stages
+	Stages       string `json:"stages,omitempty"`     // stages given on the command line
+	MaxInFlight  int    `json:"max_inflight"`         // cap on concurrent requests
+	VirtualUsers int    `json:"vus,omitempty"`        // closed-loop users instead of a request rate
+	ThinkTime    string `json:"think_time,omitempty"` // pause of virtual users between requests
+
+	Thresholds []string `json:"thresholds,omitempty"` // thresholds given on the command line
+	MaxErrors  int      `json:"max_errors,omitempty"` // failed requests after which the run is aborted
+	AbortOn    []string `json:"abort_on,omitempty"`   // conditions that abort the run when they hold
+
+	Transport TransportConfig `json:"transport"` // options of the HTTP client
+
+	ReplayFile string  `json:"replay,omitempty"` // captured traffic to send instead of a scenario
+	Speed      float64 `json:"speed,omitempty"`  // speed factor of the replay
+
+	RecordFile        string   `json:"-"` // capture to write the proxied traffic to, instead of running
+	RecordAddr        string   `json:"-"` // address the recording proxy listens on
+	RecordSkipHeaders []string `json:"-"` // headers left out of the capture
+
+	ImportFile string `json:"-"` // capture or OpenAPI spec to generate a scenario from, instead of running
+	ImportOut  string `json:"-"` // file to write the generated scenario to, stdout if empty
+
+	Search          bool          `json:"-"` // search for the highest rate meeting the thresholds, instead of running the profile
+	SearchMin       float64       `json:"-"` // rate of the first level of the search
+	SearchMax       float64       `json:"-"` // highest rate searched, unbounded if zero
+	SearchStep      float64       `json:"-"` // increase of the rate while stepping up, doubled if zero
+	SearchHold      time.Duration `json:"-"` // length of a level of the search
+	SearchPrecision float64       `json:"-"` // gap (%) between passing and failing rates to stop the search at
+
+	Agents     []string `json:"agents,omitempty"` // agents to split the load across
+	AgentAddr  string   `json:"-"`                // address to listen on as an agent
+	AgentToken string   `json:"-"`                // shared token of the agents and their coordinator
+
+	Live     string        `json:"-"` // live view: auto, table, plain or off
+	Interval time.Duration `json:"-"` // length of a live and time series interval
+
+	OutDir            string  `json:"-"` // directory for machine-readable results
+	RawFormat         string  `json:"-"` // format of the per-request log: csv, jsonl or none
+	TimeSeriesFormat  string  `json:"-"` // format of the per-interval time series: csv, jsonl or none
+	JUnitMaxErrorRate float64 `json:"-"` // error rate (%) above which an endpoint fails in JUnit
+	HTMLReport        bool    `json:"-"` // write report.html to the output directory
+	HTMLFrom          string  `json:"-"` // results directory to write report.html for instead of running
+
+	MetricsAddr string `json:"-"` // address to serve Prometheus metrics on during the run
+	PushURL     string `json:"-"` // Pushgateway compatible url to push the metrics to every interval
+
+	BaselineFile   string  `json:"-"` // summary.json of an earlier run to compare with
+	CompareFile    string  `json:"-"` // summary.json to compare with the baseline instead of running
+	Tolerance      float64 `json:"-"` // allowed change (%) of throughput and latency against the baseline
+	ErrorTolerance float64 `json:"-"` // allowed rise of the error rate, in percentage points
+}
+
+// Validate checks the options that the run itself relies on
+func (c *RunConfig) Validate() error {
+	if c.VirtualUsers < 0 {
+		return errors.New("the number of virtual users must not be negative")
+	}
+	// Open-loop runs start a worker per allowed in-flight request
+	if c.VirtualUsers == 0 && c.MaxInFlight < 1 {
+		return errors.New("max in-flight must be positive")
+	}
+	return nil
+}
+
+// NewRunConfig returns the options of a run with the defaults of the command line
+func NewRunConfig() *RunConfig {
+	return &RunConfig{
+		URL:         "https://example.com",
+		Rate:        10,
+		Duration:    10,
+		MaxInFlight: 100,
+		Transport: TransportConfig{
+			KeepAlive: true,
+			Timeout:   10 * time.Second,
+			HTTP2:     http2Auto,
+		},
+		Speed:            1,
+		RecordAddr:       ":9012",
+		SearchMin:        10,
+		SearchHold:       30 * time.Second,
+		SearchPrecision:  5,
+		Live:             "auto",
+		Interval:         time.Second,
+		RawFormat:        "csv",
+		TimeSeriesFormat: "csv",
+		HTMLReport:       true,
+		Tolerance:        10,
+		ErrorTolerance:   1,
+	}
+}
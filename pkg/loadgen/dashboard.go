@@ -0,0 +1,106 @@
+package loadgen
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dashboard prints a live view of the run, either as a table redrawn in place
+// on a terminal or as one line per interval for CI logs
+type Dashboard struct {
+	table         bool     // redraw a table in place instead of printing lines
+	profile       *Profile // load profile of the run
+	totalRequests int      // requests completed so far
+	totalErrors   int      // errors so far
+	drawnLines    int      // lines drawn by the previous table
+}
+
+// NewDashboard creates a dashboard for the given mode: "table", "plain" or
+// "auto", which picks the table when stdout is a terminal
+func NewDashboard(mode string, profile *Profile) (*Dashboard, error) {
+	d := &Dashboard{profile: profile}
+	switch mode {
+	case "table":
+		d.table = true
+	case "plain":
+	case "auto":
+		info, err := os.Stdout.Stat()
+		d.table = err == nil && info.Mode()&os.ModeCharDevice != 0
+	default:
+		return nil, fmt.Errorf("unknown live mode %q, want auto, table, plain or off", mode)
+	}
+	return d, nil
+}
+
+// OnInterval prints the latest window
+func (d *Dashboard) OnInterval(w *Window) {
+	m := w.Metrics
+	d.totalRequests += m.Requests
+	d.totalErrors += m.Errors
+
+	rps := w.rate(m.Requests)
+	target := d.profile.RateAt(w.Elapsed - w.Length/2)
+	stage := d.profile.Stages[w.Stage].Name
+	elapsed := w.Elapsed.Round(time.Second)
+
+	// Closed-loop runs have no target rate
+	targetText := ""
+	if target > 0 {
+		targetText = fmt.Sprintf(" (target %.1f)", target)
+	}
+
+	if !d.table {
+		fmt.Printf("[%6s] %s | rps %.1f%s | in-flight %d | p50 %s p99 %s | errors %d (total %d) | dropped %d\n",
+			elapsed, stage, rps, targetText, w.InFlight, m.Latency.Quantile(0.50), m.Latency.Quantile(0.99), m.Errors, d.totalErrors, w.Dropped)
+		return
+	}
+
+	var lines []string
+	lines = append(lines,
+		fmt.Sprintf("Elapsed %s / %s   stage: %s%s", elapsed, d.profile.Duration(), stage, targetText),
+		fmt.Sprintf("Achieved %.1f rps   in-flight %d   dropped %d   requests %d   errors %d (total %d)",
+			rps, w.InFlight, w.Dropped, d.totalRequests, m.Errors, d.totalErrors),
+	)
+
+	names := make([]string, 0, len(m.Endpoints))
+	width := len("Endpoint") + 2
+	for name := range m.Endpoints {
+		names = append(names, name)
+		if len(name)+2 > width {
+			width = len(name) + 2
+		}
+	}
+	sort.Strings(names)
+	lines = append(lines, fmt.Sprintf("%-*s%-10s%-13s%-13s%s", width, "Endpoint", "RPS", "p50", "p99", "Errors"))
+	for _, name := range names {
+		em := m.Endpoints[name]
+		lines = append(lines, fmt.Sprintf("%-*s%-10.1f%-13s%-13s%d", width, name, w.rate(em.Requests),
+			em.Latency.Quantile(0.50), em.Latency.Quantile(0.99), em.Errors))
+	}
+
+	// Move back to the top of the previous table and overwrite it
+	var sb strings.Builder
+	if d.drawnLines > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", d.drawnLines)
+	}
+	for _, line := range lines {
+		sb.WriteString("\033[2K")
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	// Clear leftover lines if the table got shorter
+	for i := len(lines); i < d.drawnLines; i++ {
+		sb.WriteString("\033[2K\n")
+	}
+	if len(lines) < d.drawnLines {
+		fmt.Fprintf(&sb, "\033[%dA", d.drawnLines-len(lines))
+	}
+	fmt.Print(sb.String())
+	d.drawnLines = len(lines)
+	if w.Last {
+		fmt.Println()
+	}
+}
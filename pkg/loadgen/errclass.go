@@ -0,0 +1,148 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Error categories, so a failing server can be told apart from a load
+// generator that runs out of sockets
+const (
+	errorDNS               = "dns"                // the host name could not be resolved
+	errorConnectionRefused = "connection_refused" // nothing listening on the port
+	errorConnectionReset   = "connection_reset"   // the server closed the connection
+	errorTLS               = "tls"                // TLS handshake or certificate failure
+	errorTimeout           = "timeout"            // the client timeout expired
+	errorCancelled         = "cancelled"          // the request context was cancelled
+	errorSocketsExhausted  = "sockets_exhausted"  // out of local ports or file descriptors
+	errorBodyRead          = "body_read"          // the response body could not be read
+	errorRequest           = "request"            // the request could not be built
+	errorHTTP4xx           = "http_4xx"           // client error status
+	errorHTTP5xx           = "http_5xx"           // server error status
+	errorOther             = "other"              // anything else
+)
+
+// errorSamples is the number of distinct messages kept per category
+const errorSamples = 3
+
+// ErrorClass counts the failures of one category
+type ErrorClass struct {
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"` // first distinct messages
+}
+
+// add counts a failure, keeping its message if it is a new sample
+func (c *ErrorClass) add(msg string) {
+	c.Count++
+	if len(c.Samples) >= errorSamples {
+		return
+	}
+	for _, sample := range c.Samples {
+		if sample == msg {
+			return
+		}
+	}
+	c.Samples = append(c.Samples, msg)
+}
+
+// merge adds the failures counted in other
+func (c *ErrorClass) merge(other *ErrorClass) {
+	c.Count += other.Count
+	for _, msg := range other.Samples {
+		if len(c.Samples) >= errorSamples {
+			break
+		}
+		known := false
+		for _, sample := range c.Samples {
+			known = known || sample == msg
+		}
+		if !known {
+			c.Samples = append(c.Samples, msg)
+		}
+	}
+}
+
+// requestError is an error building a request, before anything was sent
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string { return e.err.Error() }
+func (e *requestError) Unwrap() error { return e.err }
+
+// bodyReadError is an error reading the body of a response
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string { return "reading body: " + e.err.Error() }
+func (e *bodyReadError) Unwrap() error { return e.err }
+
+// classifyError returns the category of a failed request and a message for
+// it without the request url, or "" if the request succeeded. Responses with
+// an error status are failures too, although they are not transport errors.
+func classifyError(err error, status int) (string, string) {
+	if err == nil {
+		switch {
+		case status >= 500:
+			return errorHTTP5xx, fmt.Sprintf("%d %s", status, http.StatusText(status))
+		case status >= 400:
+			return errorHTTP4xx, fmt.Sprintf("%d %s", status, http.StatusText(status))
+		}
+		return "", ""
+	}
+
+	msg := errorMessage(err)
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var requestErr *requestError
+	var bodyErr *bodyReadError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &requestErr):
+		return errorRequest, msg
+	case errors.Is(err, context.Canceled):
+		return errorCancelled, msg
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return errorTimeout, msg
+	case errors.As(err, &dnsErr):
+		return errorDNS, msg
+	case errors.Is(err, syscall.EADDRNOTAVAIL), errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE):
+		return errorSocketsExhausted, msg
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorConnectionRefused, msg
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr),
+		errors.As(err, &recordErr), strings.Contains(msg, "tls: "), strings.Contains(msg, "HTTP response to HTTPS client"):
+		return errorTLS, msg
+	case errors.As(err, &bodyErr):
+		return errorBodyRead, msg
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errorConnectionReset, msg
+	}
+	return errorOther, msg
+}
+
+// errorMessage returns the message of a request error without the request
+// url, so failures of the same kind are counted together
+func errorMessage(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Op + ": " + urlErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,116 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Extractor captures a value from a response into a variable that later
+// steps of the same virtual user session can use as {{.Var "name"}}.
+// Exactly one of JSON, Header and Regex is set. Open-loop runs reject
+// scenarios whose requests extract values.
+type Extractor struct {
+	Name   string `yaml:"name" json:"name"`               // variable name
+	JSON   string `yaml:"json,omitempty" json:"json"`     // JSON path into the body, e.g. "$.ID"
+	Header string `yaml:"header,omitempty" json:"header"` // response header
+	Regex  string `yaml:"regex,omitempty" json:"regex"`   // regular expression on the body; the first group is captured if it has one
+
+	steps   []jsonPathStep // parsed JSON
+	pattern *regexp.Regexp // compiled Regex
+}
+
+// Prepare validates the extractor and compiles its path or pattern
+func (e *Extractor) Prepare() error {
+	if e.Name == "" {
+		return errors.New("extract: missing name")
+	}
+	sources := 0
+	for _, source := range []string{e.JSON, e.Header, e.Regex} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("extract %q: set exactly one of json, header and regex", e.Name)
+	}
+
+	var err error
+	if e.JSON != "" {
+		if e.steps, err = parseJSONPath(e.JSON); err != nil {
+			return fmt.Errorf("extract %q: %w", e.Name, err)
+		}
+	}
+	if e.Regex != "" {
+		if e.pattern, err = regexp.Compile(e.Regex); err != nil {
+			return fmt.Errorf("extract %q: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// needsBody reports whether the extractor reads the response body
+func (e *Extractor) needsBody() bool {
+	return e.JSON != "" || e.Regex != ""
+}
+
+// extract stores the values captured from a response in vars and returns a
+// message for every extractor that found nothing, in the same form as
+// assertion failures
+func extract(extractors []*Extractor, resp *http.Response, body []byte, vars map[string]string) []string {
+	var failures []string
+	var doc interface{}
+	var docErr error
+	parsed := false
+
+	for _, e := range extractors {
+		switch {
+		case e.Header != "":
+			value := resp.Header.Get(e.Header)
+			if value == "" {
+				failures = append(failures, fmt.Sprintf("extract %s: missing header %s", e.Name, e.Header))
+				continue
+			}
+			vars[e.Name] = value
+		case e.Regex != "":
+			match := e.pattern.FindSubmatch(body)
+			if match == nil {
+				failures = append(failures, fmt.Sprintf("extract %s: body does not match %q", e.Name, e.Regex))
+				continue
+			}
+			value := match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+			vars[e.Name] = string(value)
+		default:
+			if !parsed {
+				docErr = json.Unmarshal(body, &doc)
+				parsed = true
+			}
+			if docErr != nil {
+				failures = append(failures, fmt.Sprintf("extract %s: body is not valid JSON", e.Name))
+				continue
+			}
+			value, found := lookupJSONPath(doc, e.steps)
+			if !found {
+				failures = append(failures, fmt.Sprintf("extract %s: json %s missing", e.Name, e.JSON))
+				continue
+			}
+			vars[e.Name] = jsonString(value)
+		}
+	}
+	return failures
+}
+
+// jsonString converts a decoded JSON value to the text used in templates:
+// strings as they are, anything else in its JSON form
+func jsonString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
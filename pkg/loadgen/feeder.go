@@ -0,0 +1,138 @@
+package loadgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// FeederSpec declares a data file whose rows can be used in request templates
+type FeederSpec struct {
+	File  string `yaml:"file" json:"file"`   // CSV (with a header row) or JSONL file
+	Order string `yaml:"order" json:"order"` // "sequential" (default, wraps around) or "random"
+}
+
+// Feeder supplies rows of data read from a CSV or JSONL file
+type Feeder struct {
+	rows   []map[string]string // rows keyed by column name
+	random bool                // pick rows at random instead of in order
+	next   atomic.Int64        // index of the next sequential row
+}
+
+// LoadFeeder reads the rows of a feeder file, resolving relative paths against dir
+func LoadFeeder(spec FeederSpec, dir string) (*Feeder, error) {
+	path := spec.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = parseCSVRows(data)
+	case ".jsonl", ".ndjson":
+		rows, err = parseJSONLRows(data)
+	default:
+		return nil, fmt.Errorf("feeder %s: unsupported file type, want .csv or .jsonl", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("feeder %s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("feeder %s: no rows", path)
+	}
+
+	feeder := &Feeder{rows: rows}
+	switch spec.Order {
+	case "", "sequential":
+	case "random":
+		feeder.random = true
+	default:
+		return nil, fmt.Errorf("feeder %s: unknown order %q", path, spec.Order)
+	}
+	return feeder, nil
+}
+
+// Next returns the next row of the feeder
+func (f *Feeder) Next(rng *rand.Rand) map[string]string {
+	if f.random {
+		return f.rows[rng.Intn(len(f.rows))]
+	}
+	i := f.next.Add(1) - 1
+	return f.rows[i%int64(len(f.rows))]
+}
+
+// parseCSVRows reads CSV data whose first row holds the column names
+func parseCSVRows(data []byte) ([]map[string]string, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseJSONLRows reads one JSON object per line, converting values to strings
+func parseJSONLRows(data []byte) ([]map[string]string, error) {
+	var rows []map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		row := make(map[string]string, len(object))
+		for k, v := range object {
+			switch v := v.(type) {
+			case string:
+				row[k] = v
+			case nil:
+				row[k] = ""
+			case json.Number, bool:
+				row[k] = fmt.Sprint(v)
+			default:
+				// Nested values are kept as JSON so they can be embedded in bodies
+				encoded, err := json.Marshal(v)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				row[k] = string(encoded)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
@@ -0,0 +1,220 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// The histogram uses the HDR (high dynamic range) layout: values are grouped
+// into power-of-two buckets, each split into linear sub-buckets, which keeps
+// the relative error below 1% across the whole range with a fixed memory
+// footprint. Values are recorded in microseconds.
+const (
+	histogramSubBucketCount     = 256 // 2 significant decimal digits
+	histogramSubBucketHalfCount = histogramSubBucketCount / 2
+	histogramSubBucketHalfMag   = 7 // log2(histogramSubBucketHalfCount)
+	histogramSubBucketMask      = histogramSubBucketCount - 1
+	histogramHighestTrackable   = int64(time.Hour / time.Microsecond)
+)
+
+// histogramCountsLen is the number of counters needed to cover values up to
+// histogramHighestTrackable
+var histogramCountsLen = func() int {
+	bucketCount := 1
+	for smallestUntrackable := int64(histogramSubBucketCount); smallestUntrackable <= histogramHighestTrackable; smallestUntrackable <<= 1 {
+		bucketCount++
+	}
+	return (bucketCount + 1) * histogramSubBucketHalfCount
+}()
+
+// Histogram is a fixed-memory latency histogram that can be merged with others
+type Histogram struct {
+	counts []int64       // counters per sub-bucket
+	total  int64         // number of recorded values
+	sum    time.Duration // sum of recorded values, for the exact mean
+	min    time.Duration // smallest recorded value
+	max    time.Duration // largest recorded value
+}
+
+// NewHistogram creates an empty histogram
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make([]int64, histogramCountsLen),
+		min:    math.MaxInt64,
+	}
+}
+
+// Record adds a single latency to the histogram
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	if v > histogramHighestTrackable {
+		v = histogramHighestTrackable
+	}
+	h.counts[countsIndex(v)]++
+	h.total++
+	h.sum += d
+	if d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Merge adds all values recorded in other to the histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.total == 0 {
+		return
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.sum += other.sum
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Reset clears the histogram so it can be reused
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.total = 0
+	h.sum = 0
+	h.min = math.MaxInt64
+	h.max = 0
+}
+
+// histogramJSON is the wire form of a histogram, sent by agents to the
+// coordinator. Only non-empty counters are listed.
+type histogramJSON struct {
+	Counts [][2]int64    `json:"counts"` // pairs of counter index and count
+	Total  int64         `json:"total"`
+	Sum    time.Duration `json:"sum"`
+	Min    time.Duration `json:"min"`
+	Max    time.Duration `json:"max"`
+}
+
+// MarshalJSON writes the non-empty counters of the histogram
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	hj := histogramJSON{Counts: [][2]int64{}, Total: h.total, Sum: h.sum, Min: h.min, Max: h.max}
+	for i, c := range h.counts {
+		if c != 0 {
+			hj.Counts = append(hj.Counts, [2]int64{int64(i), c})
+		}
+	}
+	return json.Marshal(hj)
+}
+
+// UnmarshalJSON reads a histogram written by MarshalJSON
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var hj histogramJSON
+	if err := json.Unmarshal(data, &hj); err != nil {
+		return err
+	}
+	*h = *NewHistogram()
+	for _, pair := range hj.Counts {
+		if pair[0] < 0 || pair[0] >= int64(len(h.counts)) {
+			return fmt.Errorf("histogram counter %d out of range", pair[0])
+		}
+		h.counts[pair[0]] = pair[1]
+	}
+	h.total, h.sum, h.min, h.max = hj.Total, hj.Sum, hj.Min, hj.Max
+	return nil
+}
+
+// Count returns the number of recorded values
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Min returns the smallest recorded value
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.min
+}
+
+// Max returns the largest recorded value
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Mean returns the exact average of the recorded values
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Quantile returns the value below which the fraction q (0..1) of the
+// recorded values fall
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(h.total)))
+	if target < 1 {
+		target = 1
+	}
+
+	var cumulative int64
+	for i, c := range h.counts {
+		cumulative += c
+		if cumulative >= target {
+			v := time.Duration(highestEquivalentValue(i)) * time.Microsecond
+			// The bucket upper bound can overshoot the largest real value
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// CountAtOrBelow returns the number of recorded values that are at most d,
+// within the precision of the histogram
+func (h *Histogram) CountAtOrBelow(d time.Duration) int64 {
+	v := int64(d / time.Microsecond)
+	var count int64
+	for i, c := range h.counts {
+		if highestEquivalentValue(i) > v {
+			break
+		}
+		count += c
+	}
+	return count
+}
+
+// countsIndex maps a value to the index of its counter
+func countsIndex(v int64) int {
+	bucketIdx := 64 - histogramSubBucketHalfMag - 1 - bits.LeadingZeros64(uint64(v|histogramSubBucketMask))
+	subBucketIdx := int(v >> uint(bucketIdx))
+	return (bucketIdx+1)<<histogramSubBucketHalfMag + (subBucketIdx - histogramSubBucketHalfCount)
+}
+
+// highestEquivalentValue returns the largest value that maps to the counter at index
+func highestEquivalentValue(index int) int64 {
+	bucketIdx := (index >> histogramSubBucketHalfMag) - 1
+	subBucketIdx := (index & (histogramSubBucketHalfCount - 1)) + histogramSubBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= histogramSubBucketHalfCount
+		bucketIdx = 0
+	}
+	lowest := int64(subBucketIdx) << uint(bucketIdx)
+	return lowest + (int64(1) << uint(bucketIdx)) - 1
+}
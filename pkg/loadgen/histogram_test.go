@@ -0,0 +1,197 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHistogramRecordsAtBucketBoundaries(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   time.Duration
+		highest int64 // largest value, in microseconds, counted with it
+	}{
+		{"zero", 0, 0},
+		{"below a microsecond", 999 * time.Nanosecond, 0},
+		{"first bucket", 100 * time.Microsecond, 100},
+		{"end of first bucket", 255 * time.Microsecond, 255},
+		{"start of second bucket", 256 * time.Microsecond, 257},
+		{"inside a sub-bucket", 257 * time.Microsecond, 257},
+		{"end of second bucket", 511 * time.Microsecond, 511},
+		{"start of third bucket", 512 * time.Microsecond, 515},
+		{"power of two", 1024 * time.Microsecond, 1031},
+		{"second", time.Second, 1003519},
+		{"highest trackable", time.Hour, 3607101439},
+		{"beyond highest trackable", 2 * time.Hour, 3607101439},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistogram()
+			h.Record(tt.value)
+			if h.Count() != 1 || h.Max() != tt.value || h.Min() != tt.value {
+				t.Fatalf("count %d, min %s, max %s; want 1 value of %s", h.Count(), h.Min(), h.Max(), tt.value)
+			}
+			highest := time.Duration(tt.highest) * time.Microsecond
+			if got := h.CountAtOrBelow(highest); got != 1 {
+				t.Errorf("%d values at or below %s, want 1", got, highest)
+			}
+			if tt.highest > 0 {
+				// The counter below holds the values just under this one's
+				below := time.Duration(highestEquivalentValue(countsIndex(tt.highest)-1)) * time.Microsecond
+				if got := h.CountAtOrBelow(below); got != 0 {
+					t.Errorf("%d values at or below %s, want 0", got, below)
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramQuantileAccuracy(t *testing.T) {
+	tests := []struct {
+		name   string
+		values func() []time.Duration
+	}{
+		{"microseconds", func() []time.Duration {
+			var values []time.Duration
+			for i := 1; i <= 100000; i++ {
+				values = append(values, time.Duration(i)*time.Microsecond)
+			}
+			return values
+		}},
+		{"milliseconds", func() []time.Duration {
+			var values []time.Duration
+			for i := 1; i <= 1000; i++ {
+				values = append(values, time.Duration(i)*time.Millisecond)
+			}
+			return values
+		}},
+		{"long tail", func() []time.Duration {
+			var values []time.Duration
+			for i := 0; i < 990; i++ {
+				values = append(values, 5*time.Millisecond+time.Duration(i)*time.Microsecond)
+			}
+			for i := 1; i <= 10; i++ {
+				values = append(values, time.Duration(i)*time.Second)
+			}
+			return values
+		}},
+		{"constant", func() []time.Duration {
+			values := make([]time.Duration, 1000)
+			for i := range values {
+				values[i] = 42 * time.Millisecond
+			}
+			return values
+		}},
+		{"single value", func() []time.Duration {
+			return []time.Duration{1234567 * time.Microsecond}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.values()
+			h := NewHistogram()
+			for _, v := range values {
+				h.Record(v)
+			}
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+			for _, q := range []float64{0, 0.5, 0.9, 0.95, 0.99, 0.999, 1} {
+				rank := int(math.Ceil(q * float64(len(values))))
+				if rank < 1 {
+					rank = 1
+				}
+				exact := values[rank-1]
+				// Values are counted with the highest value of their
+				// sub-bucket, at most 1/128 above them
+				got := h.Quantile(q)
+				if got < exact || got > exact+exact/128+time.Microsecond {
+					t.Errorf("quantile %g = %s, want %s within 1/128", q, got, exact)
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramMergeEqualsCombinedRecording(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []time.Duration
+	}{
+		{"both empty", nil, nil},
+		{"into empty", nil, []time.Duration{time.Millisecond, 3 * time.Second}},
+		{"from empty", []time.Duration{time.Millisecond, 3 * time.Second}, nil},
+		{"disjoint ranges", []time.Duration{10 * time.Microsecond, 200 * time.Microsecond}, []time.Duration{time.Second, time.Minute}},
+		{"same sub-buckets", []time.Duration{256 * time.Microsecond, 511 * time.Microsecond}, []time.Duration{257 * time.Microsecond, 510 * time.Microsecond}},
+		{"beyond highest trackable", []time.Duration{time.Millisecond}, []time.Duration{2 * time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, combined := NewHistogram(), NewHistogram(), NewHistogram()
+			for _, v := range tt.a {
+				a.Record(v)
+				combined.Record(v)
+			}
+			for _, v := range tt.b {
+				b.Record(v)
+				combined.Record(v)
+			}
+			a.Merge(b)
+			if !reflect.DeepEqual(a, combined) {
+				t.Errorf("merged count %d, min %s, max %s, mean %s; want count %d, min %s, max %s, mean %s",
+					a.Count(), a.Min(), a.Max(), a.Mean(), combined.Count(), combined.Min(), combined.Max(), combined.Mean())
+			}
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		h := NewHistogram()
+		h.Record(time.Millisecond)
+		h.Merge(nil)
+		if h.Count() != 1 {
+			t.Errorf("count %d after merging nil, want 1", h.Count())
+		}
+	})
+}
+
+func TestHistogramJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []time.Duration
+	}{
+		{"empty", nil},
+		{"single value", []time.Duration{1500 * time.Microsecond}},
+		{"spread", []time.Duration{0, 255 * time.Microsecond, 256 * time.Microsecond, 40 * time.Millisecond, 40 * time.Millisecond, 7 * time.Second}},
+		{"beyond highest trackable", []time.Duration{2 * time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistogram()
+			for _, v := range tt.values {
+				h.Record(v)
+			}
+			data, err := json.Marshal(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := &Histogram{}
+			if err := json.Unmarshal(data, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, h) {
+				t.Errorf("decoded %s into a different histogram", data)
+			}
+		})
+	}
+
+	t.Run("counter out of range", func(t *testing.T) {
+		for _, data := range []string{`{"counts":[[-1,1]]}`, `{"counts":[[1000000,1]]}`} {
+			if err := json.Unmarshal([]byte(data), &Histogram{}); err == nil {
+				t.Errorf("decoded %s without an error", data)
+			}
+		}
+	})
+}
@@ -0,0 +1,382 @@
+package loadgen
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed htmlreport.tmpl
+var htmlReportTemplate string
+
+// chartColors are the colours of the series of a chart, in order
+var chartColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+// Chart sizes in pixels
+const (
+	chartWidth  = 760
+	chartHeight = 260
+	chartMargin = 50
+	pieSize     = 220
+)
+
+// HTMLReport collects the run-wide points of the time series, so the HTML
+// report can chart them once the run is over
+type HTMLReport struct {
+	profile *Profile
+	points  []*TimeSeriesPoint
+}
+
+// NewHTMLReport creates a collector for a run of the given profile
+func NewHTMLReport(profile *Profile) *HTMLReport {
+	return &HTMLReport{profile: profile}
+}
+
+// OnInterval keeps the run-wide point of a window
+func (r *HTMLReport) OnInterval(w *Window) {
+	stage := r.profile.Stages[w.Stage].Name
+	point := newTimeSeriesPoint(w.Start.Add(w.Length), w, "run", stage, w.Metrics)
+	point.InFlight = w.InFlight
+	point.Dropped = w.Dropped
+	r.points = append(r.points, point)
+}
+
+// Points returns the collected points; it must only be called once the run
+// has finished
+func (r *HTMLReport) Points() []*TimeSeriesPoint {
+	return r.points
+}
+
+// htmlReportData is what the report template renders
+type htmlReportData struct {
+	Title        string
+	Summary      *Summary
+	Endpoints    []*GroupSummary
+	Status       []*GroupSummary
+	Errors       []string // error categories, ordered by count
+	Config       string   // run configuration as indented JSON
+	LatencyChart template.HTML
+	RateChart    template.HTML
+	Distribution template.HTML
+	StatusChart  template.HTML
+}
+
+// WriteHTMLReport writes a self-contained HTML report of a run to path. The
+// points are the run-wide time series; without them the charts over time are
+// left out.
+func WriteHTMLReport(path string, summary *Summary, points []*TimeSeriesPoint) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"ms":      func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+		"percent": func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) + " %" },
+		"rate":    func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+		// Baseline comparisons are formatted as in the printed table
+		"compared": func(row *ComparisonRow, v float64) string { return row.format(v) },
+		"change":   func(row *ComparisonRow) string { return row.change() },
+	}).Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+
+	data := &htmlReportData{
+		Title:     "Load test report",
+		Summary:   summary,
+		Endpoints: summary.SortedEndpoints(),
+	}
+	if summary.Config != nil {
+		data.Title += ": " + summary.Config.URL
+		if summary.Config.ScenarioFile != "" {
+			data.Title = "Load test report: " + filepath.Base(summary.Config.ScenarioFile)
+		}
+		config, err := json.MarshalIndent(summary.Config, "", "  ")
+		if err != nil {
+			return err
+		}
+		data.Config = string(config)
+	}
+	for _, group := range summary.Status {
+		data.Status = append(data.Status, group)
+	}
+	sort.Slice(data.Status, func(i, j int) bool { return data.Status[i].Name < data.Status[j].Name })
+	for class := range summary.Errors {
+		data.Errors = append(data.Errors, class)
+	}
+	sort.Slice(data.Errors, func(i, j int) bool {
+		ci, cj := summary.Errors[data.Errors[i]], summary.Errors[data.Errors[j]]
+		if ci.Count != cj.Count {
+			return ci.Count > cj.Count
+		}
+		return data.Errors[i] < data.Errors[j]
+	})
+
+	if len(points) > 0 {
+		xs := make([]float64, len(points))
+		series := map[string][]float64{}
+		for i, p := range points {
+			xs[i] = p.ElapsedSeconds
+			series["p50"] = append(series["p50"], p.Latency.P50Ms)
+			series["p95"] = append(series["p95"], p.Latency.P95Ms)
+			series["p99"] = append(series["p99"], p.Latency.P99Ms)
+			series["rps"] = append(series["rps"], p.RPS)
+			series["errors/s"] = append(series["errors/s"], float64(p.Errors)/p.IntervalSeconds)
+		}
+		data.LatencyChart = lineChart(xs, []string{"p50", "p95", "p99"}, series, "ms")
+		data.RateChart = lineChart(xs, []string{"rps", "errors/s"}, series, "req/s")
+	}
+
+	l := summary.Latency
+	data.Distribution = barChart(
+		[]string{"min", "p50", "p90", "p95", "p99", "p99.9", "max"},
+		[]float64{l.MinMs, l.P50Ms, l.P90Ms, l.P95Ms, l.P99Ms, l.P999Ms, l.MaxMs},
+		"ms")
+	labels := make([]string, len(data.Status))
+	counts := make([]float64, len(data.Status))
+	for i, group := range data.Status {
+		labels[i] = group.Name
+		if group.Name == "0" {
+			// Requests without a response are recorded with status 0
+			labels[i] = "no response"
+		}
+		counts[i] = float64(group.Requests)
+	}
+	data.StatusChart = pieChart(labels, counts)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteHTMLReportFrom writes report.html into a directory of results written
+// by an earlier run, from its summary.json and time series
+func WriteHTMLReportFrom(dir string) (string, error) {
+	summary, err := LoadSummary(filepath.Join(dir, "summary.json"))
+	if err != nil {
+		return "", err
+	}
+	var points []*TimeSeriesPoint
+	for _, format := range []string{"jsonl", "csv"} {
+		points, err = LoadTimeSeries(filepath.Join(dir, "timeseries."+format), format)
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	path := filepath.Join(dir, "report.html")
+	return path, WriteHTMLReport(path, summary, points)
+}
+
+// LoadTimeSeries reads the run-wide points of a time series file in the
+// given format (csv or jsonl)
+func LoadTimeSeries(path, format string) ([]*TimeSeriesPoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var points []*TimeSeriesPoint
+	if format == "jsonl" {
+		decoder := json.NewDecoder(bufio.NewReader(file))
+		for {
+			p := &TimeSeriesPoint{}
+			if err := decoder.Decode(p); err == io.EOF {
+				return points, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if p.Scope == "run" {
+				points = append(points, p)
+			}
+		}
+	}
+
+	records, err := csv.NewReader(bufio.NewReader(file)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	column := make(map[string]int)
+	if len(records) > 0 {
+		for i, name := range records[0] {
+			column[name] = i
+		}
+	}
+	for _, name := range timeSeriesColumns {
+		if _, ok := column[name]; !ok {
+			return nil, fmt.Errorf("%s: missing column %s", path, name)
+		}
+	}
+	for _, record := range records[1:] {
+		if record[column["scope"]] != "run" {
+			continue
+		}
+		f := func(name string) float64 {
+			v, _ := strconv.ParseFloat(record[column[name]], 64)
+			return v
+		}
+		end, _ := time.Parse(time.RFC3339Nano, record[column["time"]])
+		points = append(points, &TimeSeriesPoint{
+			Time:            end,
+			ElapsedSeconds:  f("elapsed_s"),
+			IntervalSeconds: f("interval_s"),
+			Scope:           "run",
+			Stage:           record[column["stage"]],
+			Requests:        int(f("requests")),
+			Errors:          int(f("errors")),
+			Failed:          int(f("failed")),
+			RPS:             f("rps"),
+			Latency: LatencySummary{
+				MinMs:  f("min_ms"),
+				MeanMs: f("mean_ms"),
+				P50Ms:  f("p50_ms"),
+				P90Ms:  f("p90_ms"),
+				P95Ms:  f("p95_ms"),
+				P99Ms:  f("p99_ms"),
+				P999Ms: f("p99_9_ms"),
+				MaxMs:  f("max_ms"),
+			},
+			InFlight: int(f("in_flight")),
+			Dropped:  int64(f("ticks_dropped")),
+		})
+	}
+	return points, nil
+}
+
+// lineChart draws the named series over xs as an SVG line chart
+func lineChart(xs []float64, names []string, series map[string][]float64, unit string) template.HTML {
+	maxX, maxY := xs[len(xs)-1], 0.0
+	for _, name := range names {
+		for _, y := range series[name] {
+			maxY = math.Max(maxY, y)
+		}
+	}
+	maxY = niceCeil(maxY)
+	if maxX <= 0 {
+		maxX = 1
+	}
+	plotW, plotH := float64(chartWidth-2*chartMargin), float64(chartHeight-2*chartMargin)
+	px := func(x float64) float64 { return chartMargin + x/maxX*plotW }
+	py := func(y float64) float64 { return chartMargin + plotH - y/maxY*plotH }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" class="chart">`, chartWidth, chartHeight)
+	chartAxes(&b, maxY, unit)
+	for i := 0; i <= 4; i++ {
+		x := maxX * float64(i) / 4
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%ss</text>`, px(x), chartHeight-chartMargin+16, strconv.FormatFloat(x, 'f', -1, 64))
+	}
+	for i, name := range names {
+		color := chartColors[i%len(chartColors)]
+		points := make([]string, len(xs))
+		for j, x := range xs {
+			points[j] = fmt.Sprintf("%.1f,%.1f", px(x), py(series[name][j]))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(points, " "))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/><text x="%d" y="%d">%s</text>`,
+			chartMargin+i*90, 14, color, chartMargin+i*90+14, 23, template.HTMLEscapeString(name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// barChart draws one bar per label as an SVG chart
+func barChart(labels []string, values []float64, unit string) template.HTML {
+	maxY := 0.0
+	for _, v := range values {
+		maxY = math.Max(maxY, v)
+	}
+	maxY = niceCeil(maxY)
+	plotW, plotH := float64(chartWidth-2*chartMargin), float64(chartHeight-2*chartMargin)
+	slot := plotW / float64(len(values))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" class="chart">`, chartWidth, chartHeight)
+	chartAxes(&b, maxY, unit)
+	for i, v := range values {
+		h := v / maxY * plotH
+		x := chartMargin + slot*float64(i) + slot*0.15
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %.2f %s</title></rect>`,
+			x, chartMargin+plotH-h, slot*0.7, h, chartColors[0], labels[i], v, unit)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x+slot*0.35, chartHeight-chartMargin+16, labels[i])
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// chartAxes draws the axes and horizontal grid lines of a chart up to maxY
+func chartAxes(b *strings.Builder, maxY float64, unit string) {
+	bottom := chartHeight - chartMargin
+	plotH := float64(chartHeight - 2*chartMargin)
+	for i := 0; i <= 4; i++ {
+		y := float64(bottom) - plotH*float64(i)/4
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`, chartMargin, y, chartWidth-chartMargin, y)
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartMargin-6, y+4, strconv.FormatFloat(maxY*float64(i)/4, 'g', 4, 64))
+	}
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartMargin-6, chartMargin-12, template.HTMLEscapeString(unit))
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, chartMargin, bottom, chartWidth-chartMargin, bottom)
+}
+
+// pieChart draws the shares of the values as an SVG pie with a legend
+func pieChart(labels []string, values []float64) template.HTML {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	r := float64(pieSize) / 2
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" class="pie">`, pieSize+200, pieSize)
+	angle := -math.Pi / 2
+	for i, v := range values {
+		color := chartColors[i%len(chartColors)]
+		share := v / total
+		title := fmt.Sprintf("%s: %.0f (%.2f %%)", labels[i], v, share*100)
+		if share >= 1 {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"><title>%s</title></circle>`, r, r, r, color, title)
+		} else if share > 0 {
+			end := angle + share*2*math.Pi
+			large := 0
+			if share > 0.5 {
+				large = 1
+			}
+			fmt.Fprintf(&b, `<path d="M%.1f,%.1f L%.1f,%.1f A%.1f,%.1f 0 %d 1 %.1f,%.1f Z" fill="%s"><title>%s</title></path>`,
+				r, r, r+r*math.Cos(angle), r+r*math.Sin(angle), r, r, large, r+r*math.Cos(end), r+r*math.Sin(end), color, title)
+			angle = end
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/><text x="%d" y="%d">%s</text>`,
+			pieSize+20, 20+i*18, color, pieSize+36, 29+i*18, template.HTMLEscapeString(title))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten, so axis labels are round
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if v <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
@@ -0,0 +1,188 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/capture"
+	"gopkg.in/yaml.v3"
+)
+
+// importSkipHeaders are captured headers left out of imported scenarios: they
+// belong to the browser or session the traffic was captured from
+var importSkipHeaders = map[string]bool{
+	"Host":            true,
+	"Cookie":          true,
+	"User-Agent":      true,
+	"Referer":         true,
+	"Origin":          true,
+	"Accept-Language": true,
+	"Cache-Control":   true,
+	"Pragma":          true,
+}
+
+// ScenarioFromCapture creates a scenario with a request for each endpoint of
+// captured traffic, weighted by how often it was called. Endpoints are told
+// apart by method and path, with numeric path segments as {id} like in a
+// replay; each sends the path, query and body of its first capture, and
+// asserts the successful status codes it was answered with. Headers sent
+// unchanged to every endpoint become scenario headers. Requests whose body
+// was binary or too large to record are left out.
+func ScenarioFromCapture(captured []*capture.Request) (*Scenario, error) {
+	scenario := &Scenario{}
+	endpoints := make(map[string]*RequestSpec)
+	statuses := make(map[*RequestSpec]map[int]bool)
+	for _, c := range captured {
+		if c.BodyBase64 || c.BodyTruncated {
+			continue
+		}
+		name := c.Method + " " + endpointPath(c.Path)
+		spec := endpoints[name]
+		if spec == nil {
+			spec = requestFromCapture(name, c)
+			endpoints[name] = spec
+			statuses[spec] = make(map[int]bool)
+			scenario.Requests = append(scenario.Requests, spec)
+		}
+		spec.Weight++
+		if c.Status >= 200 && c.Status < 400 {
+			statuses[spec][c.Status] = true
+		}
+	}
+	if len(scenario.Requests) == 0 {
+		return nil, errors.New("no requests with a text body captured")
+	}
+
+	for _, spec := range scenario.Requests {
+		if len(statuses[spec]) > 0 {
+			spec.Assert = &Assertions{Status: sortedStatuses(statuses[spec])}
+		}
+	}
+
+	// Move the headers every request sends alike to the scenario
+	for name, value := range scenario.Requests[0].Headers {
+		common := true
+		for _, spec := range scenario.Requests[1:] {
+			if v, ok := spec.Headers[name]; !ok || v != value {
+				common = false
+				break
+			}
+		}
+		if !common {
+			continue
+		}
+		if scenario.Headers == nil {
+			scenario.Headers = make(map[string]string)
+		}
+		scenario.Headers[name] = value
+		for _, spec := range scenario.Requests {
+			delete(spec.Headers, name)
+		}
+	}
+	return scenario, nil
+}
+
+// requestFromCapture creates the request of an endpoint from a captured
+// request, quoting template delimiters in the captured text
+func requestFromCapture(name string, c *capture.Request) *RequestSpec {
+	path := c.Path
+	if c.Query != "" {
+		path += "?" + c.Query
+	}
+	spec := &RequestSpec{
+		Name:    name,
+		Method:  c.Method,
+		Path:    escapeTemplate(path),
+		Headers: make(map[string]string),
+	}
+	for header, value := range c.Headers {
+		header = http.CanonicalHeaderKey(header)
+		if importSkipHeaders[header] || capture.HopHeader(header) || strings.HasPrefix(header, "If-") || strings.HasPrefix(header, "Sec-") {
+			continue
+		}
+		spec.Headers[header] = escapeTemplate(value)
+	}
+	if c.Body == "" {
+		return spec
+	}
+
+	// JSON bodies are kept as structures, which are easier to edit into
+	// templates; application/json is the default content type of those
+	contentType := c.Headers["Content-Type"]
+	if contentType == "" || strings.Contains(contentType, "json") {
+		var body interface{}
+		if err := json.Unmarshal([]byte(c.Body), &body); err == nil {
+			switch body.(type) {
+			case map[string]interface{}, []interface{}:
+				spec.Body = escapeValue(body)
+				if strings.HasPrefix(contentType, "application/json") {
+					delete(spec.Headers, "Content-Type")
+				}
+				return spec
+			}
+		}
+	}
+	spec.Body = escapeTemplate(c.Body)
+	return spec
+}
+
+// escapeValue quotes the template delimiters in the strings of a decoded JSON
+// or YAML value. Whole numbers are turned into integers, so they are written
+// out and sent as such.
+func escapeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return escapeTemplate(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = escapeValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = escapeValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// sortedStatuses returns the status codes of a set in order
+func sortedStatuses(set map[int]bool) []int {
+	codes := make([]int, 0, len(set))
+	for code := range set {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// WriteScenario writes a scenario as YAML, as read by LoadScenario, headed by
+// comment as lines of YAML comments
+func WriteScenario(w io.Writer, scenario *Scenario, comment string) error {
+	for _, line := range strings.Split(strings.TrimSpace(comment), "\n") {
+		if _, err := fmt.Fprintln(w, strings.TrimSpace("# "+line)); err != nil {
+			return err
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(scenario); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,88 @@
+package loadgen
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/capture"
+)
+
+func TestImportedScenarioRoundTrips(t *testing.T) {
+	start := time.Now()
+	scenario, err := ScenarioFromCapture([]*capture.Request{
+		{Time: start, Method: "GET", Path: "/books", Headers: map[string]string{"Accept": "application/json"}, Status: 200},
+		{Time: start.Add(time.Second), Method: "GET", Path: "/book/3", Headers: map[string]string{"Accept": "application/json"}, Status: 200},
+		{Time: start.Add(2 * time.Second), Method: "POST", Path: "/book", Body: `{"name":"a","author_id":1}`,
+			Headers: map[string]string{"Accept": "application/json", "Content-Type": "application/json"}, Status: 201},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The parts of a scenario that are added by hand after importing
+	scenario.Stages = []Stage{
+		{Name: "ramp", Duration: Duration(30 * time.Second), From: 1, To: 50},
+		{Duration: Duration(time.Minute), Rate: 50},
+	}
+	think, err := ParseThinkTime("uniform:500ms-2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenario.Requests[2].Extract = []*Extractor{{Name: "id", JSON: "$.ID"}}
+	scenario.Session = &Session{ThinkTime: think, Steps: []*SessionStep{
+		{Request: scenario.Requests[2].Name},
+		{Request: scenario.Requests[1].Name, ThinkTime: &ThinkTime{Distribution: "exponential", Min: time.Second}},
+	}}
+
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteScenario(file, scenario, "Generated for a test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded.Stages, scenario.Stages) {
+		t.Errorf("stages %+v, want %+v", loaded.Stages, scenario.Stages)
+	}
+	if !reflect.DeepEqual(loaded.Headers, scenario.Headers) {
+		t.Errorf("headers %v, want %v", loaded.Headers, scenario.Headers)
+	}
+	if len(loaded.Requests) != len(scenario.Requests) {
+		t.Fatalf("loaded %d requests, want %d", len(loaded.Requests), len(scenario.Requests))
+	}
+	for i, spec := range scenario.Requests {
+		got := loaded.Requests[i]
+		if got.Name != spec.Name || got.Method != spec.Method || got.Path != spec.Path || got.Weight != spec.Weight {
+			t.Errorf("request %d: %s %s %s weight %d, want %s %s %s weight %d", i,
+				got.Name, got.Method, got.Path, got.Weight, spec.Name, spec.Method, spec.Path, spec.Weight)
+		}
+	}
+	if extract := loaded.Requests[2].Extract; len(extract) != 1 || extract[0].Name != "id" || extract[0].JSON != "$.ID" || extract[0].Header != "" || extract[0].Regex != "" {
+		t.Errorf("extract %+v, want the id", extract)
+	}
+	if loaded.Session == nil || len(loaded.Session.Steps) != 2 {
+		t.Fatalf("session %+v, want two steps", loaded.Session)
+	}
+	if *loaded.Session.ThinkTime != *think {
+		t.Errorf("think time %s, want %s", loaded.Session.ThinkTime, think)
+	}
+	if step := loaded.Session.Steps[1]; step.ThinkTime == nil || step.ThinkTime.String() != "exponential:1s" {
+		t.Errorf("step think time %v, want exponential:1s", step.ThinkTime)
+	}
+
+	// The loaded scenario is runnable as written
+	if err := loaded.Prepare("http://localhost"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,97 @@
+package loadgen
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+// Check is a single pass/fail verdict about a run, reported as a JUnit test case
+type Check struct {
+	Name    string // test case name
+	Group   string // test case class name
+	Passed  bool   // whether the check passed
+	Message string // explanation shown for failures
+}
+
+// endpointErrorChecks creates one check per endpoint that fails when its
+// error rate exceeds maxErrorRate percent
+func endpointErrorChecks(summary *Summary, maxErrorRate float64) []Check {
+	var checks []Check
+	for _, group := range summary.SortedEndpoints() {
+		checks = append(checks, Check{
+			Name:    group.Name,
+			Group:   "endpoints",
+			Passed:  group.ErrorRatePercent <= maxErrorRate,
+			Message: fmt.Sprintf("error rate %.2f%% (%d of %d requests), allowed %.2f%%", group.ErrorRatePercent, group.Errors, group.Requests, maxErrorRate),
+		})
+	}
+	return checks
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       float64         `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the checks of a run as a JUnit XML report
+func WriteJUnit(path string, summary *Summary, checks []Check) error {
+	suite := junitTestSuite{
+		Name:      "load_test",
+		Tests:     len(checks),
+		Time:      summary.DurationSeconds,
+		Timestamp: summary.StartTime.Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{"url", summary.Config.URL},
+			{"requests", fmt.Sprint(summary.Totals.Requests)},
+			{"target_rps", fmt.Sprintf("%.2f", summary.Totals.TargetRPS)},
+			{"achieved_rps", fmt.Sprintf("%.2f", summary.Totals.AchievedRPS)},
+			{"error_rate_percent", fmt.Sprintf("%.2f", summary.Totals.ErrorRatePercent)},
+			{"p95_ms", fmt.Sprintf("%.3f", summary.Latency.P95Ms)},
+			{"p99_ms", fmt.Sprintf("%.3f", summary.Latency.P99Ms)},
+		},
+	}
+	for _, check := range checks {
+		tc := junitTestCase{Name: check.Name, Classname: check.Group}
+		if !check.Passed {
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: check.Message, Type: "threshold", Text: check.Message}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
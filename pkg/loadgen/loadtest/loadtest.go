@@ -0,0 +1,260 @@
+// Package loadtest runs load tests inside go test, against a handler served
+// by an httptest.Server, so performance regressions fail unit test runs
+// without a deployed server. For example, against the bookstore with
+// in-memory repos and without redis, as in pkg/container:
+//
+//	func TestRouterLoad(t *testing.T) {
+//		store := repositories.NewMemoryStore()
+//		bookRepo, authorRepo := repositories.BookMemoryInstance(store), repositories.AuthorMemoryInstance(store)
+//		... // create the authors and books the scenario works on
+//		router := container.Router(bookRepo, authorRepo, nil)
+//		loadtest.Run(t, router, loadtest.Test{
+//			ScenarioFile: "testdata/load.yaml", // relative to the test's package
+//			Rate:         200,
+//			Duration:     2 * time.Second,
+//			Thresholds:   []string{"p95 < 250ms", "rps_achieved > 0.8*target"},
+//		})
+//	}
+//
+//	func BenchmarkBooks(b *testing.B) {
+//		...
+//		loadtest.Benchmark(b, router, loadtest.Test{Scenario: scenario, MaxInFlight: 16})
+//	}
+package loadtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/loadgen"
+)
+
+// Test describes a load test run in process against an http.Handler, from a
+// go test or benchmark
+type Test struct {
+	ScenarioFile string            // YAML or JSON scenario to load, instead of Scenario
+	Scenario     *loadgen.Scenario // requests to send; GET / if neither is set
+
+	// The load profile: Stages if set, else Rate for Duration if Duration is
+	// set, else the scenario's stages, else 10 requests per second for 5s
+	Stages   []loadgen.Stage
+	Rate     float64
+	Duration time.Duration
+
+	MaxInFlight  int // cap on concurrent requests, 100 if zero
+	VirtualUsers int // closed-loop users repeating the scenario's session, instead of a rate
+
+	// Thresholds in the syntax of -threshold, such as "p95 < 50ms" or
+	// "list books: error_rate < 1%", checked along with the scenario's. Any
+	// error, 5xx response or failed assertion fails the test, unless these
+	// or the scenario's thresholds set error_rate or failure_rate for the run.
+	Thresholds []string
+}
+
+// Run serves handler with an httptest.Server for the length of the test,
+// sends it the load of the test and fails tb for every threshold that is not
+// met. Requests always go to the test server, whatever base url the scenario
+// sets. The result is returned for further checks.
+func Run(tb testing.TB, handler http.Handler, test Test) *loadgen.RunResult {
+	tb.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	runner := newRunner(tb, server.URL, test)
+	result, err := runner.Run(context.Background())
+	if err != nil {
+		tb.Fatalf("load test: %v", err)
+	}
+	logResult(tb, result)
+	checkThresholds(tb, result)
+	return result
+}
+
+// newRunner prepares the scenario, profile and thresholds of a test against
+// baseURL, failing tb if one of them is invalid
+func newRunner(tb testing.TB, baseURL string, test Test) *loadgen.Runner {
+	tb.Helper()
+	scenario := test.Scenario
+	if test.ScenarioFile != "" {
+		var err error
+		if scenario, err = loadgen.LoadScenario(test.ScenarioFile); err != nil {
+			tb.Fatalf("load test: %v", err)
+		}
+	}
+	if scenario == nil {
+		scenario = loadgen.SingleURLScenario("/")
+	}
+	scenario.BaseURL = baseURL
+	if err := scenario.Prepare(baseURL); err != nil {
+		tb.Fatalf("load test: invalid scenario: %v", err)
+	}
+
+	profile := loadgen.ConstantProfile(10, 5*time.Second)
+	switch {
+	case len(test.Stages) > 0:
+		profile = &loadgen.Profile{Stages: append([]loadgen.Stage(nil), test.Stages...)}
+	case test.Duration > 0:
+		profile = loadgen.ConstantProfile(test.Rate, test.Duration)
+	case len(scenario.Stages) > 0:
+		profile = &loadgen.Profile{Stages: scenario.Stages}
+	}
+	// Virtual users run for the length of the profile, whatever its rates
+	if test.VirtualUsers > 0 {
+		profile = &loadgen.Profile{Stages: []loadgen.Stage{{Name: "virtual users", Duration: loadgen.Duration(profile.Duration())}}}
+	}
+	if err := profile.Prepare(); err != nil {
+		tb.Fatalf("load test: invalid load profile: %v", err)
+	}
+
+	thresholds := loadgen.NewThresholdSet()
+	if err := scenario.AddThresholds(thresholds); err != nil {
+		tb.Fatalf("load test: invalid threshold: %v", err)
+	}
+	for _, value := range test.Thresholds {
+		if err := thresholds.AddFlag(value); err != nil {
+			tb.Fatalf("load test: invalid threshold: %v", err)
+		}
+	}
+	for _, metric := range []string{"error_rate", "failure_rate"} {
+		if !hasRunThreshold(thresholds, metric) {
+			thresholds.Add("", metric+" <= 0")
+		}
+	}
+
+	cfg := loadgen.NewRunConfig()
+	cfg.URL = baseURL
+	cfg.ScenarioFile = test.ScenarioFile
+	cfg.VirtualUsers = test.VirtualUsers
+	cfg.Thresholds = test.Thresholds
+	cfg.Live = "off"
+	if test.MaxInFlight > 0 {
+		cfg.MaxInFlight = test.MaxInFlight
+	}
+	return &loadgen.Runner{
+		Config:     cfg,
+		Scenario:   scenario,
+		Profile:    profile,
+		ThinkTime:  scenario.SessionThinkTime(),
+		Thresholds: thresholds,
+	}
+}
+
+// hasRunThreshold reports whether thresholds check metric for the whole run
+func hasRunThreshold(thresholds *loadgen.ThresholdSet, metric string) bool {
+	for _, t := range thresholds.Run {
+		if t.Metric == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// Benchmark sends b.N requests of the test's scenario to handler as fast as
+// its in-flight cap allows, ignoring the load profile, and reports the
+// throughput and latency percentiles as benchmark metrics. Failed
+// thresholds fail the benchmark.
+func Benchmark(b *testing.B, handler http.Handler, test Test) *loadgen.RunResult {
+	b.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	runner := newRunner(b, server.URL, test)
+	if runner.Config.VirtualUsers > 0 {
+		b.Fatal("load test: virtual users cannot be benchmarked")
+	}
+	scheduler := newCountScheduler(b.N, runner.Config.MaxInFlight)
+	runner.Scheduler = scheduler
+
+	b.ResetTimer()
+	result, err := runner.Run(context.Background())
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("load test: %v", err)
+	}
+
+	summary := result.Summary
+	b.ReportMetric(summary.Totals.AchievedRPS, "req/s")
+	b.ReportMetric(summary.Latency.P50Ms, "p50-ms")
+	b.ReportMetric(summary.Latency.P95Ms, "p95-ms")
+	b.ReportMetric(summary.Latency.P99Ms, "p99-ms")
+	b.ReportMetric(summary.Totals.ErrorRatePercent, "errors-%")
+	checkThresholds(b, result)
+	return result
+}
+
+// countScheduler hands out a fixed number of ticks as fast as the in-flight
+// cap allows. Its profile has a single stage that lasts as long as the ticks
+// took, so the summary reports on the time the run really took.
+type countScheduler struct {
+	n       int
+	slots   chan struct{}
+	sent    atomic.Int64
+	profile *loadgen.Profile
+}
+
+func newCountScheduler(n, maxInFlight int) *countScheduler {
+	profile := &loadgen.Profile{Stages: []loadgen.Stage{{Name: "benchmark", Duration: loadgen.Duration(time.Second)}}}
+	profile.Prepare()
+	return &countScheduler{n: n, slots: make(chan struct{}, maxInFlight), profile: profile}
+}
+
+func (s *countScheduler) Run(ctx context.Context, ticks chan<- loadgen.Tick) {
+	defer close(ticks)
+
+	start := time.Now()
+	defer func() {
+		s.profile.Stages[0].Duration = loadgen.Duration(time.Since(start))
+	}()
+	for i := 0; i < s.n; i++ {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		s.sent.Add(1)
+		ticks <- loadgen.NewTick(time.Now(), 0, s.release)
+	}
+}
+
+func (s *countScheduler) release() {
+	<-s.slots
+}
+
+func (s *countScheduler) Profile() *loadgen.Profile {
+	return s.profile
+}
+
+func (s *countScheduler) InFlight() int {
+	return len(s.slots)
+}
+
+func (s *countScheduler) Stats() loadgen.SchedulerStats {
+	sent := s.sent.Load()
+	return loadgen.SchedulerStats{Sent: sent, StageSent: []int64{sent}, StageDropped: []int64{0}}
+}
+
+// logResult logs the outcome of a run to the test log, shown with -v or when
+// the test fails
+func logResult(tb testing.TB, result *loadgen.RunResult) {
+	tb.Helper()
+	summary := result.Summary
+	tb.Logf("load test: %d requests in %s, %.1f req/s, %.2f%% errors, %.2f%% failed assertions",
+		summary.Totals.Requests, result.Duration.Round(time.Millisecond), summary.Totals.AchievedRPS,
+		summary.Totals.ErrorRatePercent, summary.Totals.FailureRatePercent)
+	tb.Logf("load test: latency p50 %.2fms, p95 %.2fms, p99 %.2fms, max %.2fms",
+		summary.Latency.P50Ms, summary.Latency.P95Ms, summary.Latency.P99Ms, summary.Latency.MaxMs)
+}
+
+// checkThresholds fails tb for every threshold that was not met
+func checkThresholds(tb testing.TB, result *loadgen.RunResult) {
+	tb.Helper()
+	for _, r := range result.Thresholds {
+		if !r.Passed {
+			tb.Errorf("load test: threshold %s: %s failed (actual %s)", r.Scope, r.Threshold.Raw, r.Actual)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package loadtest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/loadgen"
+)
+
+// recorder is a testing.TB that records the failures and logs of a load test
+// instead of failing the test running it. Helper is the test's own, so the
+// fatal failures it passes on point at the test rather than the harness.
+type recorder struct {
+	testing.TB
+	errors []string
+	logs   []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Logf(format string, args ...interface{}) {
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.TB.Helper()
+	r.TB.Fatalf(format, args...)
+}
+
+// everyNth answers every nth request with status and the others with 200
+func everyNth(n int64, status int) http.Handler {
+	var count atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1)%n == 0 {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+// ok answers every request with 200
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+// short is a load test of 50 requests
+var short = Test{Rate: 100, Duration: 500 * time.Millisecond}
+
+func TestRunPasses(t *testing.T) {
+	result := Run(t, ok, Test{
+		Rate:       100,
+		Duration:   500 * time.Millisecond,
+		Thresholds: []string{"p95 < 100ms"},
+	})
+	if got := result.Summary.Totals.Requests; got != 50 {
+		t.Errorf("sent %d requests, want 50", got)
+	}
+	if !result.Passed() {
+		t.Error("run did not pass")
+	}
+}
+
+func TestRunFailsOnServerErrors(t *testing.T) {
+	r := &recorder{TB: t}
+	Run(r, everyNth(5, http.StatusInternalServerError), short)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "error_rate <= 0") {
+		t.Errorf("failures %q, want the default error_rate threshold", r.errors)
+	}
+	if len(r.logs) != 2 {
+		t.Errorf("logged %q, want the requests and latency of the run", r.logs)
+	}
+}
+
+func TestRunFailsOnFailedAssertions(t *testing.T) {
+	r := &recorder{TB: t}
+	test := short
+	test.Scenario = &loadgen.Scenario{
+		Requests: []*loadgen.RequestSpec{{Path: "/", Assert: &loadgen.Assertions{Status: []int{200}}}},
+	}
+	Run(r, everyNth(5, http.StatusNotFound), test)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "failure_rate <= 0") {
+		t.Errorf("failures %q, want the default failure_rate threshold", r.errors)
+	}
+}
+
+func TestRunErrorRateThreshold(t *testing.T) {
+	test := short
+	test.Thresholds = []string{"error_rate < 50%"}
+	result := Run(t, everyNth(5, http.StatusInternalServerError), test)
+	if rate := result.Summary.Totals.ErrorRatePercent; rate < 15 || rate > 25 {
+		t.Errorf("error rate %.2f%%, want 20%%", rate)
+	}
+}
+
+func TestRunFailsOnThresholds(t *testing.T) {
+	r := &recorder{TB: t}
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	test := short
+	test.Thresholds = []string{"p95 < 10ms"}
+	Run(r, slow, test)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "p95 < 10ms") {
+		t.Errorf("failures %q, want the p95 threshold", r.errors)
+	}
+}
+
+func TestRunVirtualUsers(t *testing.T) {
+	test := short
+	test.VirtualUsers = 2
+	test.Scenario = &loadgen.Scenario{
+		Requests: []*loadgen.RequestSpec{{Name: "get", Path: "/"}},
+		Session:  &loadgen.Session{Steps: []*loadgen.SessionStep{{Request: "get"}}},
+	}
+	result := Run(t, ok, test)
+	totals := result.Summary.Totals
+	if totals.Requests == 0 {
+		t.Error("virtual users sent no requests")
+	}
+	if totals.Sent != int64(totals.Requests) {
+		t.Errorf("counted %d sent, want %d", totals.Sent, totals.Requests)
+	}
+}
+
+func TestRunSessionOnlyScenario(t *testing.T) {
+	test := short
+	test.VirtualUsers = 2
+	test.Scenario = &loadgen.Scenario{
+		Session: &loadgen.Session{Steps: []*loadgen.SessionStep{
+			{RequestSpec: loadgen.RequestSpec{Name: "home", Path: "/"}},
+			{RequestSpec: loadgen.RequestSpec{Name: "about", Path: "/about"}},
+		}},
+	}
+	result := Run(t, ok, test)
+	if len(result.Summary.Endpoints) != 2 {
+		t.Errorf("got %d endpoints, want 2", len(result.Summary.Endpoints))
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	result := Benchmark(b, ok, Test{MaxInFlight: 4})
+	if got := result.Summary.Totals.Requests; got != b.N {
+		b.Errorf("sent %d requests, want %d", got, b.N)
+	}
+}
@@ -0,0 +1,175 @@
+package loadgen
+
+// Metrics aggregates request results. Each worker records into its own
+// Metrics so no locking is needed, and the runs are merged at the end.
+type Metrics struct {
+	Requests     int                        // number of completed requests
+	Errors       int                        // number of requests that returned an error or a 5xx status
+	Latency      *Histogram                 // latency of all requests
+	Status       map[int]*StatusCodeMetrics // metrics per status code (0 for errors)
+	ErrorClasses map[string]*ErrorClass     // failures per category, HTTP error statuses included
+	Failed       int                        // number of responses that failed an assertion
+	Assertions   map[string]int             // number of failed assertions per message
+	Endpoints    map[string]*Metrics        // metrics per scenario request name, nil below the top level
+	Stages       map[int]*Metrics           // metrics per profile stage index, nil below the top level
+	Phases       *PhaseMetrics              // connection phases, nil below the top level
+}
+
+// Define a struct to store the status code metrics
+type StatusCodeMetrics struct {
+	Count   int        // number of requests with this status code
+	Latency *Histogram // latency of requests with this status code
+}
+
+// NewMetrics creates an empty set of metrics with per-endpoint and per-stage breakdowns
+func NewMetrics() *Metrics {
+	m := newLeafMetrics()
+	m.Endpoints = make(map[string]*Metrics)
+	m.Stages = make(map[int]*Metrics)
+	m.Phases = NewPhaseMetrics()
+	return m
+}
+
+// newLeafMetrics creates an empty set of metrics without any breakdown
+func newLeafMetrics() *Metrics {
+	return &Metrics{
+		Latency:      NewHistogram(),
+		Status:       make(map[int]*StatusCodeMetrics),
+		ErrorClasses: make(map[string]*ErrorClass),
+		Assertions:   make(map[string]int),
+	}
+}
+
+// Record adds a single result to the metrics
+func (m *Metrics) Record(result Result) {
+	m.Requests++
+	if result.Failed() {
+		m.Errors++
+	}
+	if class, msg := classifyError(result.Err, result.Status); class != "" {
+		m.errorClass(class).add(msg)
+	}
+	if len(result.Failures) > 0 {
+		m.Failed++
+		for _, msg := range result.Failures {
+			m.Assertions[msg]++
+		}
+	}
+	m.Latency.Record(result.Latency)
+	m.statusMetrics(result.Status).record(result)
+	if m.Endpoints != nil {
+		m.endpointMetrics(result.Name).Record(result)
+	}
+	if m.Stages != nil {
+		m.stageMetrics(result.Stage).Record(result)
+	}
+	if m.Phases != nil {
+		m.Phases.Record(result.Phases)
+	}
+}
+
+// Merge adds all results recorded in other to the metrics
+func (m *Metrics) Merge(other *Metrics) {
+	m.Requests += other.Requests
+	m.Errors += other.Errors
+	m.Latency.Merge(other.Latency)
+	for class, ec := range other.ErrorClasses {
+		m.errorClass(class).merge(ec)
+	}
+	m.Failed += other.Failed
+	for msg, count := range other.Assertions {
+		m.Assertions[msg] += count
+	}
+	for status, metrics := range other.Status {
+		sm := m.statusMetrics(status)
+		sm.Count += metrics.Count
+		sm.Latency.Merge(metrics.Latency)
+	}
+	if m.Endpoints != nil {
+		for name, metrics := range other.Endpoints {
+			m.endpointMetrics(name).Merge(metrics)
+		}
+	}
+	if m.Stages != nil {
+		for stage, metrics := range other.Stages {
+			m.stageMetrics(stage).Merge(metrics)
+		}
+	}
+	if m.Phases != nil && other.Phases != nil {
+		m.Phases.Merge(other.Phases)
+	}
+}
+
+// Reset clears the metrics in place so they can be reused for the next
+// interval. Breakdown entries are kept (with zero requests) to avoid
+// reallocating their histograms.
+func (m *Metrics) Reset() {
+	m.Requests = 0
+	m.Errors = 0
+	m.Latency.Reset()
+	for _, sm := range m.Status {
+		sm.Count = 0
+		sm.Latency.Reset()
+	}
+	for class := range m.ErrorClasses {
+		delete(m.ErrorClasses, class)
+	}
+	m.Failed = 0
+	for msg := range m.Assertions {
+		delete(m.Assertions, msg)
+	}
+	for _, em := range m.Endpoints {
+		em.Reset()
+	}
+	for _, sm := range m.Stages {
+		sm.Reset()
+	}
+	if m.Phases != nil {
+		m.Phases.Reset()
+	}
+}
+
+// endpointMetrics returns the metrics for a request name, creating them if needed
+func (m *Metrics) endpointMetrics(name string) *Metrics {
+	em, ok := m.Endpoints[name]
+	if !ok {
+		em = newLeafMetrics()
+		m.Endpoints[name] = em
+	}
+	return em
+}
+
+// stageMetrics returns the metrics for a stage, creating them if needed
+func (m *Metrics) stageMetrics(stage int) *Metrics {
+	sm, ok := m.Stages[stage]
+	if !ok {
+		sm = newLeafMetrics()
+		m.Stages[stage] = sm
+	}
+	return sm
+}
+
+// errorClass returns the counter for an error category, creating it if needed
+func (m *Metrics) errorClass(class string) *ErrorClass {
+	ec, ok := m.ErrorClasses[class]
+	if !ok {
+		ec = &ErrorClass{}
+		m.ErrorClasses[class] = ec
+	}
+	return ec
+}
+
+// statusMetrics returns the metrics for a status code, creating them if needed
+func (m *Metrics) statusMetrics(status int) *StatusCodeMetrics {
+	sm, ok := m.Status[status]
+	if !ok {
+		sm = &StatusCodeMetrics{Latency: NewHistogram()}
+		m.Status[status] = sm
+	}
+	return sm
+}
+
+func (sm *StatusCodeMetrics) record(result Result) {
+	sm.Count++
+	sm.Latency.Record(result.Latency)
+}
@@ -0,0 +1,139 @@
+package loadgen
+
+import (
+	"sync"
+	"time"
+)
+
+// IntervalRecorder collects results into a short window for live views. It
+// is a ResultSink shared by all workers.
+type IntervalRecorder struct {
+	mu      sync.Mutex
+	current *Metrics // window being recorded into
+	spare   *Metrics // window handed out by the previous Swap
+}
+
+// NewIntervalRecorder creates an empty recorder
+func NewIntervalRecorder() *IntervalRecorder {
+	return &IntervalRecorder{
+		current: NewMetrics(),
+		spare:   NewMetrics(),
+	}
+}
+
+// Record adds a result to the current window
+func (r *IntervalRecorder) Record(result Result) {
+	r.mu.Lock()
+	r.current.Record(result)
+	r.mu.Unlock()
+}
+
+// Swap closes the current window and returns it. The returned metrics are
+// reused by the next call, so they must not be kept beyond it.
+func (r *IntervalRecorder) Swap() *Metrics {
+	r.spare.Reset()
+	r.mu.Lock()
+	finished := r.current
+	r.current = r.spare
+	r.mu.Unlock()
+	r.spare = finished
+	return finished
+}
+
+// Window is one interval of live results
+type Window struct {
+	Start    time.Time     // start of the interval
+	Elapsed  time.Duration // time since the start of the run at the end of the interval
+	Length   time.Duration // length of the interval
+	Metrics  *Metrics      // results completed during the interval
+	Stage    int           // index of the stage the interval ended in
+	InFlight int           // requests outstanding at the end of the interval
+	Sent     int64         // ticks handed to workers during the interval
+	Dropped  int64         // ticks dropped during the interval
+	Last     bool          // the run has finished and this is the final window
+}
+
+// rate returns requests per second over the window, zero for a window of no
+// length such as a final one closed right after the previous
+func (w *Window) rate(requests int) float64 {
+	if w.Length <= 0 {
+		return 0
+	}
+	return float64(requests) / w.Length.Seconds()
+}
+
+// IntervalListener is notified of every window of live results. The window is
+// only valid for the duration of the call.
+type IntervalListener interface {
+	OnInterval(w *Window)
+}
+
+// Monitor periodically closes the current window of live results and hands
+// it to its listeners
+type Monitor struct {
+	interval  time.Duration
+	recorder  *IntervalRecorder
+	scheduler Scheduler
+	listeners []IntervalListener
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewMonitor creates a monitor that produces a window every interval
+func NewMonitor(interval time.Duration, recorder *IntervalRecorder, scheduler Scheduler, listeners ...IntervalListener) *Monitor {
+	return &Monitor{
+		interval:  interval,
+		recorder:  recorder,
+		scheduler: scheduler,
+		listeners: listeners,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// Run produces windows until Stop is called, then emits the final partial window
+func (m *Monitor) Run(runStart time.Time) {
+	defer close(m.stopped)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	windowStart := runStart
+	var lastSent, lastDropped int64
+	emit := func(now time.Time, last bool) {
+		stats := m.scheduler.Stats()
+		sent, dropped := stats.Sent, stats.Dropped
+		elapsed := now.Sub(runStart)
+		w := &Window{
+			Start:    windowStart,
+			Elapsed:  elapsed,
+			Length:   now.Sub(windowStart),
+			Metrics:  m.recorder.Swap(),
+			Stage:    m.scheduler.Profile().StageAt(elapsed),
+			InFlight: m.scheduler.InFlight(),
+			Sent:     sent - lastSent,
+			Dropped:  dropped - lastDropped,
+			Last:     last,
+		}
+		for _, listener := range m.listeners {
+			listener.OnInterval(w)
+		}
+		windowStart, lastSent, lastDropped = now, sent, dropped
+	}
+
+	for {
+		select {
+		case now := <-ticker.C:
+			emit(now, false)
+		case <-m.done:
+			emit(time.Now(), true)
+			return
+		}
+	}
+}
+
+// Stop ends the monitor after emitting the final window and waits for it
+func (m *Monitor) Stop() {
+	close(m.done)
+	<-m.stopped
+}
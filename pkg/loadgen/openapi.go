@@ -0,0 +1,622 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIMethods are the operations of a path item that become requests
+var openAPIMethods = map[string]bool{"get": true, "put": true, "post": true, "delete": true, "patch": true}
+
+// openAPISpec is the part of an OpenAPI 3 or Swagger 2 document, in YAML or
+// JSON, that requests are generated from. Paths are kept as a node to keep
+// their order.
+type openAPISpec struct {
+	Swagger  string `yaml:"swagger"`
+	OpenAPI  string `yaml:"openapi"`
+	BasePath string `yaml:"basePath"` // Swagger 2 prefix of the paths
+	Servers  []struct {
+		URL string `yaml:"url"`
+	} `yaml:"servers"`
+	Paths yaml.Node `yaml:"paths"`
+}
+
+type openAPIOperation struct {
+	OperationID string                 `yaml:"operationId"`
+	Parameters  []*openAPIParameter    `yaml:"parameters"`
+	RequestBody *openAPIRequestBody    `yaml:"requestBody"`
+	Consumes    []string               `yaml:"consumes"` // Swagger 2 content types of the body
+	Responses   map[string]interface{} `yaml:"responses"`
+}
+
+// openAPIParameter is a parameter of an operation. Swagger 2 declares the
+// type of parameters other than the body inline, instead of in a schema.
+type openAPIParameter struct {
+	Ref      string         `yaml:"$ref"`
+	Name     string         `yaml:"name"`
+	In       string         `yaml:"in"`
+	Required bool           `yaml:"required"`
+	Example  interface{}    `yaml:"example"`
+	Schema   *openAPISchema `yaml:"schema"`
+
+	Type    openAPIType   `yaml:"type"`
+	Format  string        `yaml:"format"`
+	Enum    []interface{} `yaml:"enum"`
+	Default interface{}   `yaml:"default"`
+	Minimum *float64      `yaml:"minimum"`
+	Maximum *float64      `yaml:"maximum"`
+}
+
+type openAPIRequestBody struct {
+	Ref     string                       `yaml:"$ref"`
+	Content map[string]*openAPIMediaType `yaml:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema   *openAPISchema `yaml:"schema"`
+	Example  interface{}    `yaml:"example"`
+	Examples map[string]struct {
+		Value interface{} `yaml:"value"`
+	} `yaml:"examples"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `yaml:"$ref"`
+	Type       openAPIType               `yaml:"type"`
+	Format     string                    `yaml:"format"`
+	Example    interface{}               `yaml:"example"`
+	Enum       []interface{}             `yaml:"enum"`
+	Default    interface{}               `yaml:"default"`
+	Minimum    *float64                  `yaml:"minimum"`
+	Maximum    *float64                  `yaml:"maximum"`
+	MinLength  *int                      `yaml:"minLength"`
+	MaxLength  *int                      `yaml:"maxLength"`
+	Properties map[string]*openAPISchema `yaml:"properties"`
+	Items      *openAPISchema            `yaml:"items"`
+	AllOf      []*openAPISchema          `yaml:"allOf"`
+	OneOf      []*openAPISchema          `yaml:"oneOf"`
+	AnyOf      []*openAPISchema          `yaml:"anyOf"`
+}
+
+// openAPIType is the type of a schema; OpenAPI 3.1 allows a list of types,
+// of which the first one other than null is used
+type openAPIType string
+
+func (t *openAPIType) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return node.Decode((*string)(t))
+	}
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+	for _, name := range types {
+		if name != "null" {
+			*t = openAPIType(name)
+			break
+		}
+	}
+	return nil
+}
+
+// openAPIImporter generates requests from the operations of a spec
+type openAPIImporter struct {
+	root   *yaml.Node      // the whole document, that $refs point into
+	prefix string          // path prefix of the server or base path
+	seen   map[string]bool // schema $refs being generated, to stop at cycles
+}
+
+// ScenarioFromOpenAPI creates a scenario with a request for each operation of
+// an OpenAPI 3 or Swagger 2 spec, in YAML or JSON. Path parameters and
+// required query and header parameters are filled in from their examples, or
+// else generated from their schema with the template functions, as are
+// request bodies: every property of an object, one item of an array, a
+// {{randInt}} in the bounds of a number and a string generated for its
+// format. Requests are named by operationId and assert the 2xx and 3xx
+// status codes the operation declares. Only local $refs are followed.
+func ScenarioFromOpenAPI(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI spec %s: %w", path, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("OpenAPI spec %s is empty", path)
+	}
+	spec := &openAPISpec{}
+	if err := document.Decode(spec); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI spec %s: %w", path, err)
+	}
+	if spec.OpenAPI == "" && spec.Swagger == "" {
+		return nil, fmt.Errorf("%s is not an OpenAPI or Swagger spec", path)
+	}
+
+	imp := &openAPIImporter{root: document.Content[0], seen: make(map[string]bool)}
+	if spec.Swagger != "" {
+		imp.prefix = spec.BasePath
+	} else if len(spec.Servers) > 0 {
+		if u, err := url.Parse(spec.Servers[0].URL); err == nil {
+			imp.prefix = u.Path
+		}
+	}
+	imp.prefix = strings.TrimSuffix(imp.prefix, "/")
+
+	scenario := &Scenario{}
+	paths := spec.Paths.Content
+	for i := 0; i+1 < len(paths); i += 2 {
+		requests, err := imp.pathRequests(paths[i].Value, paths[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: path %s: %w", path, paths[i].Value, err)
+		}
+		scenario.Requests = append(scenario.Requests, requests...)
+	}
+	if len(scenario.Requests) == 0 {
+		return nil, fmt.Errorf("%s: no operations", path)
+	}
+	return scenario, nil
+}
+
+// pathRequests creates a request for each operation of a path item, in the
+// order they are declared
+func (imp *openAPIImporter) pathRequests(path string, item *yaml.Node) ([]*RequestSpec, error) {
+	item, err := imp.resolveNode(item)
+	if err != nil {
+		return nil, err
+	}
+	var shared []*openAPIParameter
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		if item.Content[i].Value == "parameters" {
+			if err := item.Content[i+1].Decode(&shared); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var requests []*RequestSpec
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		method := item.Content[i].Value
+		if !openAPIMethods[method] {
+			continue
+		}
+		op := &openAPIOperation{}
+		if err := item.Content[i+1].Decode(op); err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		spec, err := imp.operationRequest(strings.ToUpper(method), path, op, shared)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		requests = append(requests, spec)
+	}
+	return requests, nil
+}
+
+// operationRequest creates the request of an operation, with the parameters
+// shared by its path unless it overrides them
+func (imp *openAPIImporter) operationRequest(method, path string, op *openAPIOperation, shared []*openAPIParameter) (*RequestSpec, error) {
+	spec := &RequestSpec{Name: op.OperationID, Method: method}
+	if spec.Name == "" {
+		spec.Name = method + " " + path
+	}
+
+	params := make(map[string]*openAPIParameter)
+	var order []string
+	for _, p := range append(append([]*openAPIParameter(nil), shared...), op.Parameters...) {
+		if err := imp.resolve(&p.Ref, p); err != nil {
+			return nil, err
+		}
+		key := p.In + " " + p.Name
+		if _, ok := params[key]; !ok {
+			order = append(order, key)
+		}
+		params[key] = p
+	}
+
+	var query []string
+	var body interface{}
+	contentType := ""
+	for _, key := range order {
+		p := params[key]
+		switch p.In {
+		case "path":
+			value, err := imp.paramValue(p, url.PathEscape)
+			if err != nil {
+				return nil, err
+			}
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", value)
+		case "query":
+			if !p.Required && p.Example == nil && (p.Schema == nil || p.Schema.Example == nil) {
+				continue
+			}
+			value, err := imp.paramValue(p, url.QueryEscape)
+			if err != nil {
+				return nil, err
+			}
+			query = append(query, url.QueryEscape(p.Name)+"="+value)
+		case "header":
+			if !p.Required {
+				continue
+			}
+			value, err := imp.paramValue(p, func(s string) string { return s })
+			if err != nil {
+				return nil, err
+			}
+			if spec.Headers == nil {
+				spec.Headers = make(map[string]string)
+			}
+			spec.Headers[p.Name] = value
+		case "body":
+			// Swagger 2 declares the request body as a parameter
+			media := &openAPIMediaType{Schema: p.Schema}
+			contentType = "application/json"
+			if len(op.Consumes) > 0 {
+				contentType = op.Consumes[0]
+			}
+			var err error
+			if body, err = imp.mediaExample(media); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if op.RequestBody != nil {
+		if err := imp.resolve(&op.RequestBody.Ref, op.RequestBody); err != nil {
+			return nil, err
+		}
+		var media *openAPIMediaType
+		contentType, media = jsonMediaType(op.RequestBody.Content)
+		if media != nil {
+			var err error
+			if body, err = imp.mediaExample(media); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	spec.Path = imp.prefix + path
+	if len(query) > 0 {
+		spec.Path += "?" + strings.Join(query, "&")
+	}
+
+	// JSON bodies are sent as structures, other bodies only if their example
+	// is text
+	if body != nil {
+		_, text := body.(string)
+		switch {
+		case strings.Contains(contentType, "json") && !text:
+			spec.Body = body
+		case text:
+			spec.Body = body
+			if spec.Headers == nil {
+				spec.Headers = make(map[string]string)
+			}
+			spec.Headers["Content-Type"] = contentType
+		}
+	}
+
+	var codes []int
+	for code := range op.Responses {
+		if status, err := strconv.Atoi(code); err == nil && status >= 200 && status < 400 {
+			codes = append(codes, status)
+		}
+	}
+	if len(codes) > 0 {
+		sort.Ints(codes)
+		spec.Assert = &Assertions{Status: codes}
+	}
+	return spec, nil
+}
+
+// jsonMediaType picks the content type of a request body to send: JSON if
+// the operation accepts it, else the first in order
+func jsonMediaType(content map[string]*openAPIMediaType) (string, *openAPIMediaType) {
+	types := make([]string, 0, len(content))
+	for contentType := range content {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	for _, contentType := range types {
+		if strings.Contains(contentType, "json") {
+			return contentType, content[contentType]
+		}
+	}
+	if len(types) == 0 {
+		return "", nil
+	}
+	return types[0], content[types[0]]
+}
+
+// mediaExample returns the example of a request body: the one given for the
+// media type, or else one generated from its schema
+func (imp *openAPIImporter) mediaExample(media *openAPIMediaType) (interface{}, error) {
+	if media.Example != nil {
+		return escapeValue(media.Example), nil
+	}
+	names := make([]string, 0, len(media.Examples))
+	for name := range media.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := media.Examples[name].Value; value != nil {
+			return escapeValue(value), nil
+		}
+	}
+	if media.Schema == nil {
+		return nil, nil
+	}
+	value, _, err := imp.example(media.Schema)
+	return value, err
+}
+
+// paramValue returns the value of a parameter as text, escaping literal
+// examples with escape; generated values are template expressions that
+// render to text that needs no escaping
+func (imp *openAPIImporter) paramValue(p *openAPIParameter, escape func(string) string) (string, error) {
+	literal := p.Example
+	if literal == nil && p.Schema == nil {
+		switch {
+		case len(p.Enum) > 0:
+			literal = p.Enum[0]
+		case p.Default != nil:
+			literal = p.Default
+		}
+	}
+	if literal != nil {
+		return escapeTemplate(escape(fmt.Sprint(literal))), nil
+	}
+
+	schema := p.Schema
+	if schema == nil {
+		schema = &openAPISchema{Type: p.Type, Format: p.Format, Minimum: p.Minimum, Maximum: p.Maximum}
+	}
+	schema, err := imp.resolveSchema(schema)
+	if err != nil {
+		return "", err
+	}
+	if literal = schemaLiteral(schema); literal != nil {
+		return escapeTemplate(escape(fmt.Sprint(literal))), nil
+	}
+	if schema.Type == "integer" || schema.Type == "number" {
+		return numberTemplate(schema), nil
+	}
+	return stringTemplate(schema), nil
+}
+
+// example generates an example value of a schema. ok is false for a schema
+// that refers back to itself, whose value is left out.
+func (imp *openAPIImporter) example(schema *openAPISchema) (value interface{}, ok bool, err error) {
+	if ref := schema.Ref; ref != "" {
+		if imp.seen[ref] {
+			return nil, false, nil
+		}
+		imp.seen[ref] = true
+		defer delete(imp.seen, ref)
+	}
+	if schema, err = imp.resolveSchema(schema); err != nil {
+		return nil, false, err
+	}
+	if literal := schemaLiteral(schema); literal != nil {
+		return escapeValue(literal), true, nil
+	}
+
+	switch {
+	case len(schema.AllOf) > 0:
+		merged := make(map[string]interface{})
+		for _, part := range schema.AllOf {
+			value, ok, err := imp.example(part)
+			if err != nil {
+				return nil, false, err
+			}
+			if object, isObject := value.(map[string]interface{}); ok && isObject {
+				for k, v := range object {
+					merged[k] = v
+				}
+			}
+		}
+		return merged, true, nil
+	case len(schema.OneOf) > 0:
+		return imp.example(schema.OneOf[0])
+	case len(schema.AnyOf) > 0:
+		return imp.example(schema.AnyOf[0])
+	}
+
+	switch schema.Type {
+	case "integer", "number":
+		return numberTemplate(schema), true, nil
+	case "boolean":
+		return true, true, nil
+	case "string":
+		return stringTemplate(schema), true, nil
+	case "array":
+		if schema.Items == nil {
+			return []interface{}{}, true, nil
+		}
+		item, ok, err := imp.example(schema.Items)
+		if err != nil || !ok {
+			return []interface{}{}, true, err
+		}
+		return []interface{}{item}, true, nil
+	case "object", "":
+		if schema.Type == "" && len(schema.Properties) == 0 {
+			return nil, false, nil
+		}
+		object := make(map[string]interface{}, len(schema.Properties))
+		for name, property := range schema.Properties {
+			value, ok, err := imp.example(property)
+			if err != nil {
+				return nil, false, fmt.Errorf("property %s: %w", name, err)
+			}
+			if ok {
+				object[name] = value
+			}
+		}
+		return object, true, nil
+	}
+	return nil, false, nil
+}
+
+// schemaLiteral returns the value a schema gives as its example, first
+// allowed value or default, or nil if it gives none
+func schemaLiteral(schema *openAPISchema) interface{} {
+	switch {
+	case schema.Example != nil:
+		return schema.Example
+	case len(schema.Enum) > 0:
+		return schema.Enum[0]
+	default:
+		return schema.Default
+	}
+}
+
+// numberTemplate generates integers in the bounds of a numeric schema, 1 to
+// 100 unless it sets other bounds
+func numberTemplate(schema *openAPISchema) string {
+	min, max := 1, 100
+	if schema.Minimum != nil {
+		min = int(math.Ceil(*schema.Minimum))
+		max = min + 99
+	}
+	if schema.Maximum != nil {
+		max = int(math.Floor(*schema.Maximum))
+		if schema.Minimum == nil && max < min {
+			min = max - 99
+		}
+	}
+	if max < min {
+		max = min
+	}
+	return fmt.Sprintf("{{randInt %d %d}}", min, max)
+}
+
+// stringTemplate generates strings of the format of a string schema, or
+// letters in its length bounds
+func stringTemplate(schema *openAPISchema) string {
+	switch schema.Format {
+	case "email":
+		return "load-{{uuid}}@example.com"
+	case "uuid":
+		return "{{uuid}}"
+	case "date":
+		return `{{timestamp "2006-01-02"}}`
+	case "date-time":
+		return `{{timestamp "2006-01-02T15:04:05Z07:00"}}`
+	}
+	n := 8
+	if schema.MinLength != nil && n < *schema.MinLength {
+		n = *schema.MinLength
+	}
+	if schema.MaxLength != nil && n > *schema.MaxLength {
+		n = *schema.MaxLength
+	}
+	return fmt.Sprintf("{{randString %d}}", n)
+}
+
+// resolveSchema follows the $refs of a schema to the schema they point to
+func (imp *openAPIImporter) resolveSchema(schema *openAPISchema) (*openAPISchema, error) {
+	for depth := 0; schema.Ref != ""; depth++ {
+		if depth == 32 {
+			return nil, fmt.Errorf("$ref %s: too many levels", schema.Ref)
+		}
+		target := &openAPISchema{}
+		if err := imp.decodeRef(schema.Ref, target); err != nil {
+			return nil, err
+		}
+		schema = target
+	}
+	return schema, nil
+}
+
+// resolve replaces v, which holds the $ref pointed to by ref, with the value
+// the $ref points to
+func (imp *openAPIImporter) resolve(ref *string, v interface{}) error {
+	for depth := 0; *ref != ""; depth++ {
+		if depth == 32 {
+			return fmt.Errorf("$ref %s: too many levels", *ref)
+		}
+		target := *ref
+		*ref = ""
+		if err := imp.decodeRef(target, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveNode follows the $ref of a mapping node, if it has one
+func (imp *openAPIImporter) resolveNode(node *yaml.Node) (*yaml.Node, error) {
+	for depth := 0; depth < 32; depth++ {
+		ref := ""
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "$ref" {
+				ref = node.Content[i+1].Value
+			}
+		}
+		if ref == "" || node.Kind != yaml.MappingNode {
+			return node, nil
+		}
+		var err error
+		if node, err = imp.lookup(ref); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("$ref: too many levels")
+}
+
+// decodeRef decodes the value a local $ref such as
+// "#/components/schemas/Book" points to into v
+func (imp *openAPIImporter) decodeRef(ref string, v interface{}) error {
+	node, err := imp.lookup(ref)
+	if err != nil {
+		return err
+	}
+	if err := node.Decode(v); err != nil {
+		return fmt.Errorf("$ref %s: %w", ref, err)
+	}
+	return nil
+}
+
+// lookup finds the node a local $ref points to, a JSON pointer into the
+// document
+func (imp *openAPIImporter) lookup(ref string) (*yaml.Node, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("$ref %s: only refs within the spec are supported", ref)
+	}
+	node := imp.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == token {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("$ref %s: not found", ref)
+		}
+		node = next
+	}
+	return node, nil
+}
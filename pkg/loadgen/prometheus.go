@@ -0,0 +1,227 @@
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// promBuckets are the upper bounds, in seconds, of the exported latency histograms
+var promBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// promPushTimeout bounds a push, so a slow gateway cannot hold up the run
+const promPushTimeout = 5 * time.Second
+
+// Prometheus exports the live metrics of a run in the Prometheus text format,
+// on a /metrics endpoint and optionally by pushing them to a Pushgateway
+// compatible url every interval. Counters are cumulative since the start of
+// the run.
+type Prometheus struct {
+	mu       sync.Mutex
+	profile  *Profile
+	metrics  *Metrics      // results since the start of the run
+	elapsed  time.Duration // time since the start of the run
+	stage    int           // stage of the last window
+	inFlight int           // requests outstanding at the end of the last window
+	sent     int64         // ticks handed to workers
+	dropped  int64         // ticks dropped
+
+	pushURL    string
+	pushClient *http.Client
+	pushErrors int   // failed pushes
+	pushErr    error // last push error
+}
+
+// NewPrometheus creates an exporter for a run of the given profile. If
+// pushURL is set, the metrics are pushed to it after every window.
+func NewPrometheus(profile *Profile, pushURL string) *Prometheus {
+	return &Prometheus{
+		profile:    profile,
+		metrics:    NewMetrics(),
+		pushURL:    pushURL,
+		pushClient: &http.Client{Timeout: promPushTimeout},
+	}
+}
+
+// OnInterval adds the results of a window and pushes the metrics
+func (p *Prometheus) OnInterval(w *Window) {
+	p.mu.Lock()
+	p.metrics.Merge(w.Metrics)
+	p.elapsed = w.Elapsed
+	p.stage = w.Stage
+	p.inFlight = w.InFlight
+	p.sent += w.Sent
+	p.dropped += w.Dropped
+	p.mu.Unlock()
+
+	if p.pushURL != "" {
+		p.push()
+	}
+}
+
+// push sends the current metrics to the push url, replacing the ones pushed before
+func (p *Prometheus) push() {
+	var buf bytes.Buffer
+	p.WriteTo(&buf)
+	req, err := http.NewRequest(http.MethodPut, p.pushURL, &buf)
+	if err == nil {
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+		var resp *http.Response
+		if resp, err = p.pushClient.Do(req); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("push: %s", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		p.mu.Lock()
+		p.pushErrors++
+		p.pushErr = err
+		p.mu.Unlock()
+	}
+}
+
+// PushError returns an error describing the failed pushes, or nil if every
+// push succeeded
+func (p *Prometheus) PushError() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pushErrors == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d pushes failed, last: %w", p.pushErrors, p.pushErr)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// ServePrometheus serves the metrics of p on addr at /metrics until the
+// process exits. The listener is opened before returning, so a port that is
+// already taken fails the run before it starts.
+func ServePrometheus(addr string, p *Prometheus) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p)
+	server := &http.Server{Addr: addr, Handler: mux}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go server.Serve(listener)
+	return nil
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (p *Prometheus) WriteTo(out io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w := &promWriter{}
+	m := p.metrics
+	endpoints := make([]string, 0, len(m.Endpoints))
+	for name := range m.Endpoints {
+		endpoints = append(endpoints, name)
+	}
+	sort.Strings(endpoints)
+
+	w.header("loadtest_requests_total", "counter", "Requests completed, by endpoint and status code (0 when there was no response).")
+	for _, name := range endpoints {
+		em := m.Endpoints[name]
+		codes := make([]int, 0, len(em.Status))
+		for code := range em.Status {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			w.sample("loadtest_requests_total", []string{"endpoint", name, "status", strconv.Itoa(code)}, float64(em.Status[code].Count))
+		}
+	}
+
+	w.header("loadtest_errors_total", "counter", "Failed requests, by endpoint and error category.")
+	for _, name := range endpoints {
+		em := m.Endpoints[name]
+		classes := make([]string, 0, len(em.ErrorClasses))
+		for class := range em.ErrorClasses {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			w.sample("loadtest_errors_total", []string{"endpoint", name, "category", class}, float64(em.ErrorClasses[class].Count))
+		}
+	}
+
+	w.header("loadtest_failed_assertions_total", "counter", "Responses that failed an assertion, by endpoint.")
+	for _, name := range endpoints {
+		w.sample("loadtest_failed_assertions_total", []string{"endpoint", name}, float64(m.Endpoints[name].Failed))
+	}
+
+	w.header("loadtest_request_duration_seconds", "histogram", "Latency of completed requests, by endpoint.")
+	for _, name := range endpoints {
+		h := m.Endpoints[name].Latency
+		for _, bound := range promBuckets {
+			count := h.CountAtOrBelow(time.Duration(bound * float64(time.Second)))
+			w.sample("loadtest_request_duration_seconds_bucket", []string{"endpoint", name, "le", strconv.FormatFloat(bound, 'g', -1, 64)}, float64(count))
+		}
+		w.sample("loadtest_request_duration_seconds_bucket", []string{"endpoint", name, "le", "+Inf"}, float64(h.Count()))
+		w.sample("loadtest_request_duration_seconds_sum", []string{"endpoint", name}, h.sum.Seconds())
+		w.sample("loadtest_request_duration_seconds_count", []string{"endpoint", name}, float64(h.Count()))
+	}
+
+	w.header("loadtest_in_flight", "gauge", "Requests outstanding.")
+	w.sample("loadtest_in_flight", nil, float64(p.inFlight))
+	w.header("loadtest_target_rps", "gauge", "Request rate the load profile asks for.")
+	w.sample("loadtest_target_rps", nil, p.profile.RateAt(p.elapsed))
+	w.header("loadtest_stage", "gauge", "Index of the current stage of the load profile.")
+	w.sample("loadtest_stage", []string{"name", p.profile.Stages[p.stage].Name}, float64(p.stage))
+	w.header("loadtest_ticks_sent_total", "counter", "Ticks handed to workers.")
+	w.sample("loadtest_ticks_sent_total", nil, float64(p.sent))
+	w.header("loadtest_ticks_dropped_total", "counter", "Ticks dropped because the in-flight cap was reached.")
+	w.sample("loadtest_ticks_dropped_total", nil, float64(p.dropped))
+	w.header("loadtest_elapsed_seconds", "gauge", "Time since the start of the run.")
+	w.sample("loadtest_elapsed_seconds", nil, p.elapsed.Seconds())
+
+	n, err := out.Write(w.buf.Bytes())
+	return int64(n), err
+}
+
+// promWriter builds a Prometheus text exposition
+type promWriter struct {
+	buf bytes.Buffer
+}
+
+// header writes the help and type lines of a metric
+func (w *promWriter) header(name, kind, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one sample; labels alternate between names and values
+func (w *promWriter) sample(name string, labels []string, value float64) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, "%s=\"%s\"", labels[i], promLabelEscaper.Replace(labels[i+1]))
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteByte('\n')
+}
+
+// promLabelEscaper escapes label values as the text format requires
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,122 @@
+package loadgen
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rawLogColumns are the columns of the per-request CSV log
+var rawLogColumns = []string{"time", "worker", "name", "stage", "method", "url", "status", "latency_ms", "wait_ms", "size", "error", "failed_assertions"}
+
+// RawLogEntry is one line of the per-request JSONL log
+type RawLogEntry struct {
+	Time      time.Time `json:"time"`
+	Worker    int       `json:"worker"`
+	Name      string    `json:"name"`
+	Stage     int       `json:"stage"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	WaitMs    float64   `json:"wait_ms"` // part of the latency spent waiting to be sent
+	Size      int64     `json:"size"`
+	Error     string    `json:"error,omitempty"`
+	Failed    []string  `json:"failed_assertions,omitempty"`
+}
+
+// RawLog writes one line per request to a CSV or JSONL file. It is shared by
+// all workers, so writes are serialised with a mutex.
+type RawLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	buf     *bufio.Writer
+	csv     *csv.Writer   // set for the csv format
+	encoder *json.Encoder // set for the jsonl format
+}
+
+// NewRawLog creates the log file at path in the given format (csv or jsonl)
+func NewRawLog(path, format string) (*RawLog, error) {
+	if format != "csv" && format != "jsonl" {
+		return nil, fmt.Errorf("unknown raw log format %q, want csv or jsonl", format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &RawLog{file: file, buf: bufio.NewWriter(file)}
+	if format == "csv" {
+		l.csv = csv.NewWriter(l.buf)
+		l.csv.Write(rawLogColumns)
+	} else {
+		l.encoder = json.NewEncoder(l.buf)
+	}
+	return l, nil
+}
+
+// Record appends a result to the log
+func (l *RawLog) Record(result Result) {
+	entry := RawLogEntry{
+		Time:      result.Start,
+		Worker:    result.WorkerID,
+		Name:      result.Name,
+		Stage:     result.Stage,
+		Method:    result.Method,
+		URL:       result.URL,
+		Status:    result.Status,
+		LatencyMs: durationMs(result.Latency),
+		WaitMs:    durationMs(result.Wait),
+		Size:      result.Size,
+		Failed:    result.Failures,
+	}
+	if result.Err != nil {
+		entry.Error = result.Err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.csv != nil {
+		l.csv.Write([]string{
+			entry.Time.Format(time.RFC3339Nano),
+			strconv.Itoa(entry.Worker),
+			entry.Name,
+			strconv.Itoa(entry.Stage),
+			entry.Method,
+			entry.URL,
+			strconv.Itoa(entry.Status),
+			strconv.FormatFloat(entry.LatencyMs, 'f', 3, 64),
+			strconv.FormatFloat(entry.WaitMs, 'f', 3, 64),
+			strconv.FormatInt(entry.Size, 10),
+			entry.Error,
+			strings.Join(entry.Failed, "; "),
+		})
+		return
+	}
+	l.encoder.Encode(entry)
+}
+
+// Close flushes the log and closes the file
+func (l *RawLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.csv != nil {
+		l.csv.Flush()
+	}
+	if err := l.buf.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,144 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/capture"
+)
+
+// Replay is captured traffic turned into a scenario, one request per
+// captured request, to be sent at the offsets they arrived at
+type Replay struct {
+	Scenario *Scenario
+	Skipped  int             // captured requests left out, as their body was not recorded
+	offsets  []time.Duration // arrival of each request since the first one
+}
+
+// NewReplay creates a replay of captured requests, sorted by arrival time as
+// capture.Load returns them. Requests are named by method and path, without
+// the query and with numeric path segments as {id}, so the report groups
+// them by endpoint. Requests whose body was too large to record are left out
+// rather than sent without it.
+func NewReplay(captured []*capture.Request) (*Replay, error) {
+	if len(captured) == 0 {
+		return nil, errors.New("no requests to replay")
+	}
+	r := &Replay{Scenario: &Scenario{}}
+	var first time.Time
+	for i, c := range captured {
+		if c.BodyTruncated {
+			r.Skipped++
+			continue
+		}
+		if len(r.offsets) == 0 {
+			first = c.Time
+		}
+		body, err := c.RequestBody()
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", i+1, err)
+		}
+		path := c.Path
+		if c.Query != "" {
+			path += "?" + c.Query
+		}
+		spec := &RequestSpec{
+			Name:    c.Method + " " + endpointPath(c.Path),
+			Method:  c.Method,
+			Path:    escapeTemplate(path),
+			Headers: make(map[string]string, len(c.Headers)),
+		}
+		for name, value := range c.Headers {
+			spec.Headers[name] = escapeTemplate(value)
+		}
+		if len(body) > 0 {
+			spec.Body = escapeTemplate(string(body))
+		}
+		r.Scenario.Requests = append(r.Scenario.Requests, spec)
+		r.offsets = append(r.offsets, c.Time.Sub(first))
+	}
+	if len(r.offsets) == 0 {
+		return nil, errors.New("no requests with a recorded body to replay")
+	}
+	return r, nil
+}
+
+// endpointPath replaces the numeric segments of a path, usually ids, with {id}
+func endpointPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// escapeTemplate quotes the template delimiters in captured text, so it is
+// sent as it was recorded
+func escapeTemplate(s string) string {
+	return strings.ReplaceAll(s, "{{", "{{`{{`}}")
+}
+
+// Scheduler creates a scheduler that sends the requests of the replay at
+// their captured offsets divided by speed, e.g. twice as fast with a speed
+// of 2. The scenario must be prepared first.
+func (r *Replay) Scheduler(speed float64, maxInFlight int) (*ReplayScheduler, error) {
+	if speed <= 0 {
+		return nil, errors.New("replay speed must be positive")
+	}
+	offsets := make([]time.Duration, len(r.offsets))
+	for i, offset := range r.offsets {
+		offsets[i] = time.Duration(float64(offset) / speed)
+	}
+
+	// A single stage covering the replay, at its average rate; the last
+	// request is given a millisecond so the stage never has zero length
+	duration := offsets[len(offsets)-1] + time.Millisecond
+	profile := &Profile{Stages: []Stage{{
+		Name:     "replay",
+		Duration: Duration(duration),
+		Rate:     float64(len(offsets)) / duration.Seconds(),
+	}}}
+	if err := profile.Prepare(); err != nil {
+		return nil, err
+	}
+	return &ReplayScheduler{
+		ArrivalScheduler: NewArrivalScheduler(profile, maxInFlight),
+		requests:         r.Scenario.Requests,
+		offsets:          offsets,
+	}, nil
+}
+
+// ReplayScheduler sends captured requests at the offsets they were captured
+// at, open loop like the ArrivalScheduler whose counters and in-flight cap it
+// shares
+type ReplayScheduler struct {
+	*ArrivalScheduler
+	requests []*RequestSpec
+	offsets  []time.Duration
+}
+
+// Run emits one tick per captured request, each set to send its request,
+// until all were sent or ctx is done and then closes the channel
+func (s *ReplayScheduler) Run(ctx context.Context, ticks chan<- Tick) {
+	defer close(ticks)
+
+	start := time.Now()
+	for i, spec := range s.requests {
+		scheduled := start.Add(s.offsets[i])
+		if !sleepContext(ctx, time.Until(scheduled)) {
+			return
+		}
+		// A request is late once it slips by more than the gap to the one before
+		var gap time.Duration
+		if i > 0 {
+			gap = s.offsets[i] - s.offsets[i-1]
+		}
+		tick := Tick{scheduled: scheduled, release: s.release}
+		s.dispatch(ticks, tick.WithRequest(spec), gap)
+	}
+}
@@ -0,0 +1,220 @@
+package loadgen
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// reportPercentiles are the latency percentiles printed in the report
+var reportPercentiles = []struct {
+	label    string
+	quantile float64
+}{
+	{"p50", 0.50},
+	{"p90", 0.90},
+	{"p95", 0.95},
+	{"p99", 0.99},
+	{"p99.9", 0.999},
+}
+
+// printReport prints the summary of a run to stdout
+func printReport(metrics *Metrics, scheduler Scheduler, runDuration time.Duration) {
+	profile := scheduler.Profile()
+	stats := scheduler.Stats()
+	targetRate := float64(profile.TotalArrivals()) / profile.Duration().Seconds()
+	achievedRate := float64(metrics.Requests) / runDuration.Seconds()
+
+	fmt.Println("Total Number of Requests:", metrics.Requests)
+	fmt.Println("Average Latency:", metrics.Latency.Mean())
+	// Closed-loop runs have no target rate and no ticks
+	if targetRate > 0 {
+		fmt.Printf("Requests Per Second: %.2f\n", targetRate)
+	}
+	fmt.Printf("Achieved Requests Per Second: %.2f\n", achievedRate)
+	if targetRate > 0 {
+		fmt.Println("Dropped Ticks (in-flight cap reached):", stats.Dropped)
+		fmt.Println("Late Ticks:", stats.Late)
+	}
+	fmt.Println("Min Latency:", metrics.Latency.Min())
+	fmt.Println("Max Latency:", metrics.Latency.Max())
+	fmt.Println("Error Rate:", errorRate(metrics.Errors, metrics.Requests), "%")
+	fmt.Println("Failed Assertions:", metrics.Failed, fmt.Sprintf("(%.2f %%)", errorRate(metrics.Failed, metrics.Requests)))
+
+	fmt.Println("Latency Percentiles:")
+	for _, p := range reportPercentiles {
+		fmt.Printf("  %-7s%s\n", p.label, metrics.Latency.Quantile(p.quantile))
+	}
+
+	// Print the connection phases
+	if metrics.Phases != nil && metrics.Phases.Connections > 0 {
+		fmt.Printf("Connection Reuse: %.2f %% (%d new connections)\n", metrics.Phases.ReusePercent(), metrics.Phases.Connections-metrics.Phases.Reused)
+		printLatencyHeader("Phase", 10)
+		for i, h := range metrics.Phases.histograms() {
+			printLatencyRow(phaseNames[i], 10, int(h.Count()), h)
+		}
+	}
+
+	// Print the per-stage breakdown for staged profiles
+	if len(profile.Stages) > 1 {
+		fmt.Println()
+		printStages(metrics, scheduler, runDuration)
+		fmt.Println()
+	}
+
+	// Print status codes in a stable order
+	statuses := make([]int, 0, len(metrics.Status))
+	for status := range metrics.Status {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	printLatencyHeader("Status Code", 13)
+	for _, status := range statuses {
+		sm := metrics.Status[status]
+		printLatencyRow(fmt.Sprint(status), 13, sm.Count, sm.Latency)
+	}
+
+	// Print the per-endpoint breakdown when the scenario has several requests
+	if len(metrics.Endpoints) > 1 {
+		names := make([]string, 0, len(metrics.Endpoints))
+		width := len("Endpoint") + 2
+		for name := range metrics.Endpoints {
+			names = append(names, name)
+			if len(name)+2 > width {
+				width = len(name) + 2
+			}
+		}
+		sort.Strings(names)
+
+		fmt.Println()
+		printLatencyHeader("Endpoint", width)
+		for _, name := range names {
+			em := metrics.Endpoints[name]
+			printLatencyRow(name, width, em.Requests, em.Latency)
+		}
+		fmt.Printf("%-*s%-9s%-12s%-9s%s\n", width, "Endpoint", "Errors", "Error Rate", "Failed", "Failure Rate")
+		for _, name := range names {
+			em := metrics.Endpoints[name]
+			fmt.Printf("%-*s%-9d%-12s%-9d%.2f %%\n", width, name, em.Errors, fmt.Sprintf("%.2f %%", errorRate(em.Errors, em.Requests)),
+				em.Failed, errorRate(em.Failed, em.Requests))
+		}
+	}
+
+	// Print the failures by category, most frequent first
+	if len(metrics.ErrorClasses) > 0 {
+		classes := make([]string, 0, len(metrics.ErrorClasses))
+		for class := range metrics.ErrorClasses {
+			classes = append(classes, class)
+		}
+		sort.Slice(classes, func(i, j int) bool {
+			if metrics.ErrorClasses[classes[i]].Count != metrics.ErrorClasses[classes[j]].Count {
+				return metrics.ErrorClasses[classes[i]].Count > metrics.ErrorClasses[classes[j]].Count
+			}
+			return classes[i] < classes[j]
+		})
+
+		fmt.Println()
+		fmt.Printf("%-20s%-9s%s\n", "Error Category", "Counts", "Sample Messages")
+		for _, class := range classes {
+			ec := metrics.ErrorClasses[class]
+			for i, sample := range ec.Samples {
+				if i == 0 {
+					fmt.Printf("%-20s%-9d%s\n", class, ec.Count, sample)
+				} else {
+					fmt.Printf("%-29s%s\n", "", sample)
+				}
+			}
+		}
+	}
+
+	// Print the failed assertions, most frequent first
+	if len(metrics.Assertions) > 0 {
+		messages := make([]string, 0, len(metrics.Assertions))
+		for msg := range metrics.Assertions {
+			messages = append(messages, msg)
+		}
+		sort.Slice(messages, func(i, j int) bool {
+			if metrics.Assertions[messages[i]] != metrics.Assertions[messages[j]] {
+				return metrics.Assertions[messages[i]] > metrics.Assertions[messages[j]]
+			}
+			return messages[i] < messages[j]
+		})
+
+		fmt.Println()
+		fmt.Printf("%-9s%s\n", "Counts", "Failed Assertion")
+		for _, msg := range messages {
+			fmt.Printf("%-9d%s\n", metrics.Assertions[msg], msg)
+		}
+	}
+}
+
+// printSessions prints the sessions run by virtual users
+func printSessions(sessions *SessionMetrics, vus int, runDuration time.Duration) {
+	total := sessions.Completed + sessions.Failed
+	fmt.Println("Virtual Users:", vus)
+	fmt.Println("Sessions:", total)
+	fmt.Printf("Sessions Per Second: %.2f\n", float64(total)/runDuration.Seconds())
+	fmt.Println("Failed Sessions:", sessions.Failed, fmt.Sprintf("(%.2f %%)", errorRate(sessions.Failed, total)))
+	printLatencyHeader("Session", 9)
+	printLatencyRow("all", 9, total, sessions.Duration)
+}
+
+// printStages prints the target and achieved load and the latency of each
+// stage, the achieved load over the part of the stage the run got through
+func printStages(metrics *Metrics, scheduler Scheduler, runDuration time.Duration) {
+	stages := scheduler.Profile().Stages
+	stats := scheduler.Stats()
+	width := len("Stage") + 2
+	for _, stage := range stages {
+		if len(stage.Name)+2 > width {
+			width = len(stage.Name) + 2
+		}
+	}
+
+	fmt.Printf("%-*s%-10s%-17s%-11s%-9s%-9s%-12s%-13s%-13s%-13s%-13s\n", width, "Stage", "Duration", "Target RPS", "Achieved", "Dropped", "Errors", "Error Rate", "p50", "p95", "p99", "Max")
+	for i, stage := range stages {
+		sm, ok := metrics.Stages[i]
+		if !ok {
+			sm = newLeafMetrics()
+		}
+		target := fmt.Sprintf("%g", stage.From)
+		if stage.From != stage.To {
+			target = fmt.Sprintf("%g -> %g", stage.From, stage.To)
+		}
+		duration := time.Duration(stage.Duration)
+		var achieved float64
+		if ran := scheduler.Profile().StageRan(i, runDuration); ran > 0 {
+			achieved = float64(sm.Requests) / ran.Seconds()
+		}
+		fmt.Printf("%-*s%-10s%-17s%-11.2f%-9d%-9d%-12s%-13s%-13s%-13s%-13s\n", width, stage.Name, duration, target, achieved,
+			stats.stageDropped(i), sm.Errors, fmt.Sprintf("%.2f %%", errorRate(sm.Errors, sm.Requests)),
+			sm.Latency.Quantile(0.50), sm.Latency.Quantile(0.95), sm.Latency.Quantile(0.99), sm.Latency.Max())
+	}
+}
+
+// printLatencyHeader prints the header of a latency table whose first column is width wide
+func printLatencyHeader(label string, width int) {
+	fmt.Printf("%-*s%-9s%-13s", width, label, "Counts", "Min")
+	for _, p := range reportPercentiles {
+		fmt.Printf("%-13s", p.label)
+	}
+	fmt.Printf("%-13s%-13s\n", "Max", "Avg")
+}
+
+// printLatencyRow prints one row of a latency table
+func printLatencyRow(label string, width int, count int, h *Histogram) {
+	fmt.Printf("%-*s%-9d%-13s", width, label, count, h.Min())
+	for _, p := range reportPercentiles {
+		fmt.Printf("%-13s", h.Quantile(p.quantile))
+	}
+	fmt.Printf("%-13s%-13s\n", h.Max(), h.Mean())
+}
+
+// errorRate returns the percentage of failed requests, guarding against empty runs
+func errorRate(errors, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(errors) / float64(total) * 100
+}
@@ -0,0 +1,77 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// ConsoleReporter prints the report of a run, its thresholds and its
+// comparison with the baseline to stdout
+type ConsoleReporter struct{}
+
+// Report prints the tables of the run
+func (ConsoleReporter) Report(result *RunResult) error {
+	printReport(result.Metrics, result.Scheduler, result.Duration)
+	if result.Aborted != "" {
+		fmt.Println("Run aborted:", result.Aborted)
+	}
+	if result.Sessions != nil {
+		fmt.Println()
+		printSessions(result.Sessions, result.Summary.Config.VirtualUsers, result.Duration)
+	}
+	if len(result.Thresholds) > 0 {
+		fmt.Println()
+		printThresholds(result.Thresholds)
+	}
+	if result.Summary.Comparison != nil {
+		fmt.Println()
+		PrintComparison(result.Summary.Comparison)
+	}
+	return nil
+}
+
+// FileReporter writes the machine-readable results of a run to a directory:
+// summary.json, junit.xml and, with HTML set, report.html. The per-request
+// log and the time series fed during the run are closed first.
+type FileReporter struct {
+	Dir        string
+	RawLog     *RawLog     // closed once the run is over, if set
+	TimeSeries *TimeSeries // closed once the run is over, if set
+	HTML       *HTMLReport // charts of report.html, not written if nil
+
+	JUnitMaxErrorRate float64 // error rate (%) above which an endpoint fails in junit.xml
+}
+
+// Report writes the results, returning every error it ran into
+func (f *FileReporter) Report(result *RunResult) error {
+	var errs []error
+	if f.RawLog != nil {
+		if err := f.RawLog.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("writing request log: %w", err))
+		}
+	}
+	if f.TimeSeries != nil {
+		if err := f.TimeSeries.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("writing time series: %w", err))
+		}
+	}
+
+	summary := result.Summary
+	checks := endpointErrorChecks(summary, f.JUnitMaxErrorRate)
+	checks = append(checks, thresholdChecks(result.Thresholds)...)
+	if summary.Comparison != nil {
+		checks = append(checks, summary.Comparison.Checks()...)
+	}
+	if err := writeResults(f.Dir, summary, checks); err != nil {
+		errs = append(errs, fmt.Errorf("writing results: %w", err))
+	} else {
+		fmt.Println("Results written to", f.Dir)
+	}
+	if f.HTML != nil {
+		if err := WriteHTMLReport(filepath.Join(f.Dir, "report.html"), summary, f.HTML.Points()); err != nil {
+			errs = append(errs, fmt.Errorf("writing HTML report: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,238 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Summary is the machine-readable result of a run, written to summary.json
+type Summary struct {
+	Config          *RunConfig                `json:"config"`
+	Stages          []Stage                   `json:"stages"`
+	StartTime       time.Time                 `json:"start_time"`
+	DurationSeconds float64                   `json:"duration_seconds"`
+	Totals          TotalsSummary             `json:"totals"`
+	Latency         LatencySummary            `json:"latency"`
+	Phases          map[string]LatencySummary `json:"phases"`
+	Status          map[string]*GroupSummary  `json:"status"`
+	Endpoints       map[string]*GroupSummary  `json:"endpoints"`
+	StageResults    []*GroupSummary           `json:"stage_results"`
+	Errors          map[string]*ErrorClass    `json:"errors"`
+	Assertions      map[string]int            `json:"failed_assertions"`
+	Thresholds      []ThresholdSummary        `json:"thresholds,omitempty"`
+	Sessions        *SessionSummary           `json:"sessions,omitempty"`
+	Aborted         string                    `json:"aborted,omitempty"`
+	Comparison      *Comparison               `json:"comparison,omitempty"`
+}
+
+// SessionSummary holds the sessions of a virtual user run
+type SessionSummary struct {
+	VirtualUsers       int            `json:"virtual_users"`
+	ThinkTime          *ThinkTime     `json:"think_time,omitempty"`
+	Sessions           int            `json:"sessions"`
+	Failed             int            `json:"failed"`
+	FailureRatePercent float64        `json:"failure_rate_percent"`
+	SessionsPerSecond  float64        `json:"sessions_per_second"`
+	Duration           LatencySummary `json:"duration"`
+}
+
+// NewSessionSummary summarises the sessions of a run that lasted runDuration
+func NewSessionSummary(sessions *SessionMetrics, vus int, thinkTime *ThinkTime, runDuration time.Duration) *SessionSummary {
+	total := sessions.Completed + sessions.Failed
+	return &SessionSummary{
+		VirtualUsers:       vus,
+		ThinkTime:          thinkTime,
+		Sessions:           total,
+		Failed:             sessions.Failed,
+		FailureRatePercent: errorRate(sessions.Failed, total),
+		SessionsPerSecond:  float64(total) / runDuration.Seconds(),
+		Duration:           NewLatencySummary(sessions.Duration),
+	}
+}
+
+// ThresholdSummary is the outcome of one threshold
+type ThresholdSummary struct {
+	Scope     string `json:"scope"`
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
+// TotalsSummary holds the overall counters of a run
+type TotalsSummary struct {
+	Requests               int     `json:"requests"`
+	Errors                 int     `json:"errors"`
+	ErrorRatePercent       float64 `json:"error_rate_percent"`
+	Failed                 int     `json:"failed"`
+	FailureRatePercent     float64 `json:"failure_rate_percent"`
+	TargetRPS              float64 `json:"target_rps"`
+	AchievedRPS            float64 `json:"achieved_rps"`
+	Sent                   int64   `json:"ticks_sent"`
+	Dropped                int64   `json:"ticks_dropped"`
+	Late                   int64   `json:"ticks_late"`
+	ConnectionReusePercent float64 `json:"connection_reuse_percent"`
+}
+
+// GroupSummary holds the counters and latency of one status code, endpoint or stage
+type GroupSummary struct {
+	Name               string         `json:"name"`
+	Requests           int            `json:"requests"`
+	Errors             int            `json:"errors"`
+	ErrorRatePercent   float64        `json:"error_rate_percent"`
+	Failed             int            `json:"failed"`
+	FailureRatePercent float64        `json:"failure_rate_percent"`
+	RPS                float64        `json:"rps"`
+	TargetRPS          float64        `json:"target_rps,omitempty"`
+	Dropped            int64          `json:"ticks_dropped,omitempty"`
+	Latency            LatencySummary `json:"latency"`
+}
+
+// LatencySummary holds latency statistics in milliseconds
+type LatencySummary struct {
+	MinMs  float64 `json:"min_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p99_9_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// NewLatencySummary summarises a histogram
+func NewLatencySummary(h *Histogram) LatencySummary {
+	return LatencySummary{
+		MinMs:  durationMs(h.Min()),
+		MeanMs: durationMs(h.Mean()),
+		P50Ms:  durationMs(h.Quantile(0.50)),
+		P90Ms:  durationMs(h.Quantile(0.90)),
+		P95Ms:  durationMs(h.Quantile(0.95)),
+		P99Ms:  durationMs(h.Quantile(0.99)),
+		P999Ms: durationMs(h.Quantile(0.999)),
+		MaxMs:  durationMs(h.Max()),
+	}
+}
+
+// BuildSummary collects the results of a finished run
+func BuildSummary(cfg *RunConfig, scenario *Scenario, metrics *Metrics, scheduler Scheduler, startTime time.Time, runDuration time.Duration) *Summary {
+	profile := scheduler.Profile()
+	stats := scheduler.Stats()
+	seconds := runDuration.Seconds()
+
+	summary := &Summary{
+		Config:          cfg,
+		Stages:          profile.Stages,
+		StartTime:       startTime,
+		DurationSeconds: seconds,
+		Totals: TotalsSummary{
+			Requests:           metrics.Requests,
+			Errors:             metrics.Errors,
+			ErrorRatePercent:   errorRate(metrics.Errors, metrics.Requests),
+			Failed:             metrics.Failed,
+			FailureRatePercent: errorRate(metrics.Failed, metrics.Requests),
+			TargetRPS:          float64(profile.TotalArrivals()) / profile.Duration().Seconds(),
+			AchievedRPS:        float64(metrics.Requests) / seconds,
+			Sent:               stats.Sent,
+			Dropped:            stats.Dropped,
+			Late:               stats.Late,
+		},
+		Latency:    NewLatencySummary(metrics.Latency),
+		Status:     make(map[string]*GroupSummary),
+		Endpoints:  make(map[string]*GroupSummary),
+		Errors:     metrics.ErrorClasses,
+		Assertions: metrics.Assertions,
+		Phases:     make(map[string]LatencySummary),
+	}
+
+	if metrics.Phases != nil {
+		summary.Totals.ConnectionReusePercent = metrics.Phases.ReusePercent()
+		for i, h := range metrics.Phases.histograms() {
+			summary.Phases[phaseNames[i]] = NewLatencySummary(h)
+		}
+	}
+
+	for status, sm := range metrics.Status {
+		name := strconv.Itoa(status)
+		summary.Status[name] = &GroupSummary{
+			Name:     name,
+			Requests: sm.Count,
+			RPS:      float64(sm.Count) / seconds,
+			Latency:  NewLatencySummary(sm.Latency),
+		}
+	}
+	for name, em := range metrics.Endpoints {
+		summary.Endpoints[name] = newGroupSummary(name, em, seconds)
+	}
+	// Each endpoint's share of the target rate follows its weight
+	for _, spec := range scenario.Requests {
+		if group, ok := summary.Endpoints[spec.Name]; ok {
+			group.TargetRPS += summary.Totals.TargetRPS * float64(spec.Weight) / float64(scenario.totalWeight)
+		}
+	}
+	for i, stage := range profile.Stages {
+		sm, ok := metrics.Stages[i]
+		if !ok {
+			sm = newLeafMetrics()
+		}
+		// A stage cut short by the end of the run is rated over the part that ran
+		group := newGroupSummary(stage.Name, sm, profile.StageRan(i, runDuration).Seconds())
+		group.TargetRPS = (stage.From + stage.To) / 2
+		group.Dropped = stats.stageDropped(i)
+		summary.StageResults = append(summary.StageResults, group)
+	}
+	return summary
+}
+
+// newGroupSummary summarises the metrics of an endpoint or stage that lasted
+// seconds, with no rate if it did not run at all
+func newGroupSummary(name string, m *Metrics, seconds float64) *GroupSummary {
+	group := &GroupSummary{
+		Name:               name,
+		Requests:           m.Requests,
+		Errors:             m.Errors,
+		ErrorRatePercent:   errorRate(m.Errors, m.Requests),
+		Failed:             m.Failed,
+		FailureRatePercent: errorRate(m.Failed, m.Requests),
+		Latency:            NewLatencySummary(m.Latency),
+	}
+	if seconds > 0 {
+		group.RPS = float64(m.Requests) / seconds
+	}
+	return group
+}
+
+// SortedEndpoints returns the endpoint summaries ordered by name
+func (s *Summary) SortedEndpoints() []*GroupSummary {
+	endpoints := make([]*GroupSummary, 0, len(s.Endpoints))
+	for _, group := range s.Endpoints {
+		endpoints = append(endpoints, group)
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Name < endpoints[j].Name })
+	return endpoints
+}
+
+// writeJSONFile writes v as indented JSON to path
+func writeJSONFile(path string, v interface{}) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// Keep thresholds such as "p95 < 200ms" readable
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// writeResults writes summary.json and junit.xml to the output directory
+func writeResults(dir string, summary *Summary, checks []Check) error {
+	if err := writeJSONFile(filepath.Join(dir, "summary.json"), summary); err != nil {
+		return err
+	}
+	return WriteJUnit(filepath.Join(dir, "junit.xml"), summary, checks)
+}
@@ -0,0 +1,36 @@
+package loadgen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildSummaryRatesStagesOverTheirRun(t *testing.T) {
+	profile := &Profile{Stages: []Stage{
+		{Duration: Duration(10 * time.Second), Rate: 10},
+		{Duration: Duration(10 * time.Second), Rate: 10},
+		{Duration: Duration(10 * time.Second), Rate: 10},
+	}}
+	if err := profile.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	scenario := SingleURLScenario("/")
+	if err := scenario.Prepare("http://localhost"); err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewMetrics()
+	for i := 0; i < 100; i++ {
+		metrics.Record(Result{Name: "GET /", Stage: 0, Status: 200, Latency: time.Millisecond})
+	}
+	for i := 0; i < 40; i++ {
+		metrics.Record(Result{Name: "GET /", Stage: 1, Status: 200, Latency: time.Millisecond})
+	}
+
+	// The run was stopped 4s into the second stage
+	summary := BuildSummary(NewRunConfig(), scenario, metrics, NewArrivalScheduler(profile, 10), time.Now(), 14*time.Second)
+	for i, want := range []float64{10, 10, 0} {
+		if got := summary.StageResults[i].RPS; got != want {
+			t.Errorf("stage %d: %g rps, want %g", i+1, got, want)
+		}
+	}
+}
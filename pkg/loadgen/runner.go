@@ -0,0 +1,157 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Runner runs a load test: it sends the requests of a scenario on a load
+// profile, here or split across agents, and hands the outcome to its
+// reporters. Config, Scenario and Profile are required; the other fields
+// have defaults.
+type Runner struct {
+	Config   *RunConfig // options of the run, recorded in the summary
+	Scenario *Scenario  // requests to send, already prepared
+	Profile  *Profile   // arrival rate over time, already prepared
+
+	// Target sends the requests; an HTTP client built from Config.Transport
+	// if nil. Agents always send over HTTP.
+	Target Target
+	// Scheduler hands out the ticks the workers send on; the arrival rate of
+	// Profile, capped at Config.MaxInFlight, if nil. It is not used for
+	// virtual users or agents.
+	Scheduler Scheduler
+
+	ThinkTime  *ThinkTime    // pause of virtual users between requests
+	Thresholds *ThresholdSet // pass/fail conditions, none if nil
+	Baseline   *Summary      // earlier run to compare with, Config.BaselineFile names it
+
+	Sinks     []ResultSink       // receive every result
+	Listeners []IntervalListener // receive the results of every interval
+	Reporters []Reporter         // present the outcome, in order
+}
+
+// RunResult is the outcome of a run
+type RunResult struct {
+	Metrics    *Metrics          // results of all requests
+	Sessions   *SessionMetrics   // results of the virtual users, nil without them
+	Scheduler  Scheduler         // scheduler the run followed
+	Start      time.Time         // time the run started
+	Duration   time.Duration     // length of the run
+	Summary    *Summary          // machine-readable summary
+	Thresholds []ThresholdResult // outcome of every threshold
+	Aborted    string            // why the run was stopped early, "" if it was not
+}
+
+// Passed reports whether all thresholds were met
+func (r *RunResult) Passed() bool {
+	for _, t := range r.Thresholds {
+		if !t.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Regressed reports whether the run was worse than its baseline
+func (r *RunResult) Regressed() bool {
+	return r.Summary.Comparison != nil && r.Summary.Comparison.Regressions > 0
+}
+
+// Reporter presents the outcome of a finished run
+type Reporter interface {
+	Report(result *RunResult) error
+}
+
+// Run runs the profile until its end or until ctx is done; requests already
+// in flight are then left to complete and the run is reported as aborted,
+// with the cause of ctx as the reason. The reporters are called even if some
+// of them fail, and their errors are returned together.
+func (r *Runner) Run(ctx context.Context) (*RunResult, error) {
+	cfg := r.Config
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.VirtualUsers > 0 && len(cfg.Agents) > 0 {
+		return nil, errors.New("virtual users cannot be split across agents")
+	}
+	if cfg.VirtualUsers == 0 {
+		if err := r.Scenario.checkOpenLoop(); err != nil {
+			return nil, err
+		}
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	target := r.Target
+	if target == nil {
+		client, err := cfg.Transport.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		target = NewHTTPTarget(client)
+	}
+	thresholds := r.Thresholds
+	if thresholds == nil {
+		thresholds = NewThresholdSet()
+	}
+
+	sinks := append([]ResultSink(nil), r.Sinks...)
+	var live *IntervalRecorder
+	if len(r.Listeners) > 0 {
+		live = NewIntervalRecorder()
+		sinks = append(sinks, live)
+	}
+
+	// Run the profile, either here or split across the agents, or run the
+	// virtual users
+	result := &RunResult{}
+	switch {
+	case cfg.VirtualUsers > 0:
+		// Every user has at most one request in flight
+		scheduler := NewArrivalScheduler(r.Profile, cfg.VirtualUsers)
+		result.Scheduler = scheduler
+		result.Metrics, result.Sessions, result.Start, result.Duration = runVirtualUsers(ctx, r.Scenario, target, scheduler, cfg.VirtualUsers, r.ThinkTime, sinks, live, interval, r.Listeners)
+	case len(cfg.Agents) > 0:
+		scheduler := NewArrivalScheduler(r.Profile, cfg.MaxInFlight)
+		result.Scheduler = scheduler
+		var err error
+		result.Metrics, result.Start, result.Duration, err = runDistributed(ctx, cfg, r.Profile, scheduler, r.Listeners)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		scheduler := r.Scheduler
+		if scheduler == nil {
+			scheduler = NewArrivalScheduler(r.Profile, cfg.MaxInFlight)
+		}
+		result.Scheduler = scheduler
+		result.Metrics, result.Start, result.Duration = runWorkers(ctx, r.Scenario, target, scheduler, cfg.MaxInFlight, sinks, live, interval, r.Listeners)
+	}
+	if ctx.Err() != nil {
+		result.Aborted = context.Cause(ctx).Error()
+	}
+
+	// Evaluate the thresholds and compare with the baseline
+	summary := BuildSummary(cfg, r.Scenario, result.Metrics, result.Scheduler, result.Start, result.Duration)
+	result.Thresholds = thresholds.Evaluate(summary)
+	summary.Thresholds = thresholdSummaries(result.Thresholds)
+	summary.Aborted = result.Aborted
+	if result.Sessions != nil {
+		summary.Sessions = NewSessionSummary(result.Sessions, cfg.VirtualUsers, r.ThinkTime, result.Duration)
+	}
+	if r.Baseline != nil {
+		summary.Comparison = Compare(cfg.BaselineFile, r.Baseline, summary, cfg.Tolerance, cfg.ErrorTolerance)
+	}
+	result.Summary = summary
+
+	var errs []error
+	for _, reporter := range r.Reporters {
+		if err := reporter.Report(result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return result, errors.Join(errs...)
+}
@@ -0,0 +1,343 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario describes the weighted mix of requests sent during a run
+type Scenario struct {
+	BaseURL string                `yaml:"base_url,omitempty" json:"base_url"` // prefixed to every request path
+	Headers map[string]string     `yaml:"headers,omitempty" json:"headers"`   // sent with every request
+	Feeders map[string]FeederSpec `yaml:"feeders,omitempty" json:"feeders"`   // data files usable in templates
+	Stages  []Stage               `yaml:"stages,omitempty" json:"stages"`     // load profile, overrides -rps/-dur
+	Assert  *Assertions           `yaml:"assert,omitempty" json:"assert"`     // checked on every response, unless a request sets its own
+
+	Thresholds         []string       `yaml:"thresholds,omitempty" json:"thresholds"`                   // checked against the run totals
+	EndpointThresholds []string       `yaml:"endpoint_thresholds,omitempty" json:"endpoint_thresholds"` // checked against every request name
+	Requests           []*RequestSpec `yaml:"requests,omitempty" json:"requests"`                       // requests to choose from
+	Session            *Session       `yaml:"session,omitempty" json:"session"`                         // steps of a virtual user session
+
+	dir         string             // directory that feeder paths are relative to
+	feeders     map[string]*Feeder // loaded feeders by name
+	generators  *Generators        // state of the built-in template functions
+	totalWeight int                // sum of the request weights
+}
+
+// RequestSpec describes one kind of request in a scenario. Path, header
+// values and body may contain template expressions (see Generators.Funcs and
+// TemplateData.Feed).
+type RequestSpec struct {
+	Name    string            `yaml:"name,omitempty" json:"name"`       // name used in the report
+	Method  string            `yaml:"method,omitempty" json:"method"`   // HTTP method, GET by default
+	Path    string            `yaml:"path,omitempty" json:"path"`       // path (and query) relative to the base URL
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers"` // extra headers for this request
+	Body    interface{}       `yaml:"body,omitempty" json:"body"`       // raw string or a structure sent as JSON
+	Weight  int               `yaml:"weight,omitempty" json:"weight"`   // relative frequency, 1 by default
+
+	Thresholds []string     `yaml:"thresholds,omitempty" json:"thresholds"` // override endpoint_thresholds for this request
+	Assert     *Assertions  `yaml:"assert,omitempty" json:"assert"`         // checks on the response, replacing the scenario's
+	Extract    []*Extractor `yaml:"extract,omitempty" json:"extract"`       // values to capture from the response
+
+	assert   *Assertions          // assertions in effect
+	readBody bool                 // assertions or extractors need the response body
+	url      *Template            // request URL
+	body     interface{}          // compiled body, see compileValue
+	jsonBody bool                 // body is a structure to be encoded as JSON
+	headers  map[string]*Template // merged scenario and request headers
+}
+
+// LoadScenario reads a scenario from a YAML or JSON file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scenario := &Scenario{dir: filepath.Dir(path)}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, scenario)
+	} else {
+		err = yaml.Unmarshal(data, scenario)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing scenario %s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// SingleURLScenario creates a scenario that only sends GET requests to url
+func SingleURLScenario(url string) *Scenario {
+	return &Scenario{
+		Requests: []*RequestSpec{{Name: "GET " + url, Path: url}},
+	}
+}
+
+// Prepare validates the scenario, loads its feeders and compiles the request
+// templates. baseURL is used when the scenario does not set one itself.
+func (s *Scenario) Prepare(baseURL string) error {
+	if len(s.Requests) == 0 && s.Session == nil {
+		return errors.New("scenario has no requests")
+	}
+	if s.BaseURL == "" {
+		s.BaseURL = baseURL
+	}
+	s.BaseURL = strings.TrimSuffix(s.BaseURL, "/")
+
+	s.feeders = make(map[string]*Feeder, len(s.Feeders))
+	for name, spec := range s.Feeders {
+		feeder, err := LoadFeeder(spec, s.dir)
+		if err != nil {
+			return err
+		}
+		s.feeders[name] = feeder
+	}
+
+	if s.Assert != nil {
+		if err := s.Assert.Prepare(); err != nil {
+			return fmt.Errorf("scenario assert: %w", err)
+		}
+	}
+
+	s.generators = &Generators{}
+	funcs := s.generators.Funcs()
+
+	s.totalWeight = 0
+	for i, spec := range s.Requests {
+		if spec.Weight == 0 {
+			spec.Weight = 1
+		}
+		if spec.Weight < 0 {
+			return fmt.Errorf("request %d: weight must not be negative", i)
+		}
+		if err := s.prepareRequest(spec, funcs); err != nil {
+			return err
+		}
+		s.totalWeight += spec.Weight
+	}
+	if len(s.Requests) > 0 && s.totalWeight == 0 {
+		return errors.New("scenario requests have no weight")
+	}
+
+	if s.Session != nil {
+		if len(s.Session.Steps) == 0 {
+			return errors.New("session has no steps")
+		}
+		for i, step := range s.Session.Steps {
+			// A step either names a request of the scenario or describes its own
+			if step.Request == "" {
+				if step.Path == "" {
+					return fmt.Errorf("session step %d: set request or path", i+1)
+				}
+				step.spec = &step.RequestSpec
+				if err := s.prepareRequest(step.spec, funcs); err != nil {
+					return fmt.Errorf("session step %d: %w", i+1, err)
+				}
+				continue
+			}
+			for _, spec := range s.Requests {
+				if spec.Name == step.Request {
+					step.spec = spec
+					break
+				}
+			}
+			if step.spec == nil {
+				return fmt.Errorf("session step %d: unknown request %q", i+1, step.Request)
+			}
+		}
+	}
+	return nil
+}
+
+// prepareRequest fills in the defaults of a request and compiles its templates,
+// assertions and extractors
+func (s *Scenario) prepareRequest(spec *RequestSpec, funcs template.FuncMap) error {
+	if spec.Method == "" {
+		spec.Method = http.MethodGet
+	}
+	spec.Method = strings.ToUpper(spec.Method)
+	if spec.Name == "" {
+		spec.Name = spec.Method + " " + spec.Path
+	}
+
+	url := spec.Path
+	if !strings.Contains(spec.Path, "://") {
+		url = s.BaseURL + "/" + strings.TrimPrefix(spec.Path, "/")
+	}
+	var err error
+	if spec.url, err = ParseTemplate(spec.Name+" path", url, funcs); err != nil {
+		return fmt.Errorf("request %q: %w", spec.Name, err)
+	}
+
+	_, rawBody := spec.Body.(string)
+	spec.jsonBody = spec.Body != nil && !rawBody
+	if spec.body, err = compileValue(spec.Name+" body", spec.Body, funcs); err != nil {
+		return fmt.Errorf("request %q: %w", spec.Name, err)
+	}
+
+	spec.headers = make(map[string]*Template)
+	headers := make(map[string]string)
+	for k, v := range s.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	for k, v := range spec.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	if spec.Body != nil && headers["Content-Type"] == "" {
+		headers["Content-Type"] = "application/json"
+	}
+	for k, v := range headers {
+		if spec.headers[k], err = ParseTemplate(spec.Name+" header "+k, v, funcs); err != nil {
+			return fmt.Errorf("request %q: %w", spec.Name, err)
+		}
+	}
+
+	spec.assert = s.Assert
+	if spec.Assert != nil {
+		if err := spec.Assert.Prepare(); err != nil {
+			return fmt.Errorf("request %q: assert: %w", spec.Name, err)
+		}
+		spec.assert = spec.Assert
+	}
+	spec.readBody = spec.assert != nil && spec.assert.NeedsBody()
+	for _, e := range spec.Extract {
+		if err := e.Prepare(); err != nil {
+			return fmt.Errorf("request %q: %w", spec.Name, err)
+		}
+		spec.readBody = spec.readBody || e.needsBody()
+	}
+	return nil
+}
+
+// SessionSteps returns the steps of a virtual user session. Without a session
+// in the scenario, a session is a single request picked by weight, which is
+// marked by a step without a request.
+func (s *Scenario) SessionSteps() []*SessionStep {
+	if s.Session == nil {
+		return []*SessionStep{{}}
+	}
+	return s.Session.Steps
+}
+
+// SessionThinkTime returns the think time of the scenario's session, if any
+func (s *Scenario) SessionThinkTime() *ThinkTime {
+	if s.Session == nil {
+		return nil
+	}
+	return s.Session.ThinkTime
+}
+
+// AddThresholds adds the thresholds declared in the scenario to ts
+func (s *Scenario) AddThresholds(ts *ThresholdSet) error {
+	for _, expr := range s.Thresholds {
+		if err := ts.Add("", expr); err != nil {
+			return err
+		}
+	}
+	for _, expr := range s.EndpointThresholds {
+		if err := ts.Add("*", expr); err != nil {
+			return err
+		}
+	}
+	specs := s.Requests
+	if s.Session != nil {
+		for _, step := range s.Session.Steps {
+			if step.Request == "" {
+				specs = append(specs, &step.RequestSpec)
+			}
+		}
+	}
+	for _, spec := range specs {
+		for _, expr := range spec.Thresholds {
+			if err := ts.Add(spec.Name, expr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Pick chooses a request according to the configured weights
+func (s *Scenario) Pick(rng *rand.Rand) *RequestSpec {
+	n := rng.Intn(s.totalWeight)
+	for _, spec := range s.Requests {
+		if n < spec.Weight {
+			return spec
+		}
+		n -= spec.Weight
+	}
+	return s.Requests[len(s.Requests)-1]
+}
+
+// checkOpenLoop returns an error if the scenario has no requests outside its
+// session, or if a request extracts values, which only works for the
+// sessions of virtual users: in an open-loop run a value would go to
+// whichever worker sent the request, and be used by the unrelated requests
+// that worker happens to send next
+func (s *Scenario) checkOpenLoop() error {
+	if len(s.Requests) == 0 {
+		return errors.New("the scenario only has a session, which needs virtual users (-vus)")
+	}
+	for _, spec := range s.Requests {
+		if len(spec.Extract) > 0 {
+			return fmt.Errorf("request %q extracts values, which is only supported in the session of virtual users (-vus)", spec.Name)
+		}
+	}
+	return nil
+}
+
+// NewTemplateData creates the context for rendering one request of the scenario
+func (s *Scenario) NewTemplateData(vars map[string]string, rng *rand.Rand) *TemplateData {
+	return NewTemplateData(s.feeders, vars, rng)
+}
+
+// NewRequest renders the spec's templates and builds the HTTP request
+func (spec *RequestSpec) NewRequest(data *TemplateData) (*http.Request, error) {
+	url, err := spec.url.Render(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if spec.jsonBody {
+		rendered, err := renderValue(spec.body, data)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(rendered)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(encoded)
+	} else if spec.body != nil {
+		rendered, err := spec.body.(*Template).Render(data)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+
+	req, err := http.NewRequest(spec.Method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, t := range spec.headers {
+		value, err := t.Render(data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, value)
+	}
+	return req, nil
+}
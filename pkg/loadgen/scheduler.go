@@ -0,0 +1,222 @@
+package loadgen
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler decides when the workers send their requests. Run hands ticks out
+// on the channel until the profile is over or ctx is done and then closes it;
+// each tick holds an in-flight slot until its request completes.
+type Scheduler interface {
+	Run(ctx context.Context, ticks chan<- Tick)
+	Profile() *Profile
+	InFlight() int
+	Stats() SchedulerStats
+}
+
+// Tick is a single request slot emitted by a Scheduler
+type Tick struct {
+	scheduled time.Time // time at which the request was due to be sent
+	stage     int       // index of the profile stage the tick belongs to
+	release   func()    // frees the in-flight slot held by this tick
+
+	request *RequestSpec // request to send, picked from the scenario if nil
+}
+
+// NewTick creates a tick for a custom Scheduler; release is called once the
+// request sent for the tick completes
+func NewTick(scheduled time.Time, stage int, release func()) Tick {
+	if release == nil {
+		release = func() {}
+	}
+	return Tick{scheduled: scheduled, stage: stage, release: release}
+}
+
+// WithRequest returns the tick set to send spec instead of a request picked
+// from the scenario
+func (t Tick) WithRequest(spec *RequestSpec) Tick {
+	t.request = spec
+	return t
+}
+
+// Done releases the in-flight slot taken by the tick once its request completes
+func (t Tick) Done() {
+	t.release()
+}
+
+// ArrivalScheduler emits ticks on the arrival schedule of a load profile (open
+// loop), regardless of how long the requests already in flight take to complete
+type ArrivalScheduler struct {
+	profile *Profile      // stages describing the arrival rate over time
+	slots   chan struct{} // one entry per request currently in flight
+	sent    atomic.Int64  // ticks handed to a worker
+	dropped atomic.Int64  // ticks skipped because the in-flight cap was reached
+	late    atomic.Int64  // ticks dispatched noticeably behind their schedule
+
+	stageSent    []atomic.Int64 // sent ticks per stage
+	stageDropped []atomic.Int64 // dropped ticks per stage
+}
+
+// NewArrivalScheduler creates a new scheduler for a prepared profile, allowing at
+// most maxInFlight requests to be outstanding at any time
+func NewArrivalScheduler(profile *Profile, maxInFlight int) *ArrivalScheduler {
+	return &ArrivalScheduler{
+		profile:      profile,
+		slots:        make(chan struct{}, maxInFlight),
+		stageSent:    make([]atomic.Int64, len(profile.Stages)),
+		stageDropped: make([]atomic.Int64, len(profile.Stages)),
+	}
+}
+
+// Run emits ticks until the profile is exhausted or ctx is done and then
+// closes the channel. The ticks channel must be buffered to at least
+// maxInFlight. Taking a slot is non-blocking: if the in-flight cap is reached
+// the tick is counted as dropped instead of delaying the ticks that follow it.
+func (s *ArrivalScheduler) Run(ctx context.Context, ticks chan<- Tick) {
+	defer close(ticks)
+
+	start := time.Now()
+	for i := 0; ; i++ {
+		// Derive every slot from the start time so rounding errors do not drift
+		offset, stage, rate, ok := s.profile.Arrival(i)
+		if !ok {
+			// Let the last stage run to its end before finishing
+			sleepContext(ctx, time.Until(start.Add(s.profile.Duration())))
+			return
+		}
+		scheduled := start.Add(offset)
+		if !sleepContext(ctx, time.Until(scheduled)) {
+			return
+		}
+
+		// A tick is late once it slips by more than one interval
+		var interval time.Duration
+		if rate > 0 {
+			interval = time.Duration(float64(time.Second) / rate)
+		}
+		s.dispatch(ticks, Tick{scheduled: scheduled, stage: stage, release: s.release}, interval)
+	}
+}
+
+// dispatch hands a tick out if an in-flight slot is free, and counts it as
+// dropped otherwise instead of delaying the ticks that follow it. The tick is
+// counted as late if it slipped by more than lateAfter, or 1ms so timer
+// granularity alone does not flag every tick at high rates.
+func (s *ArrivalScheduler) dispatch(ticks chan<- Tick, tick Tick, lateAfter time.Duration) {
+	if lateAfter < time.Millisecond {
+		lateAfter = time.Millisecond
+	}
+	if time.Since(tick.scheduled) > lateAfter {
+		s.late.Add(1)
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		s.sent.Add(1)
+		s.stageSent[tick.stage].Add(1)
+		ticks <- tick
+	default:
+		s.dropped.Add(1)
+		s.stageDropped[tick.stage].Add(1)
+	}
+}
+
+// SchedulerStats are the tick counters of a scheduler, sent by agents to the
+// coordinator so it can report on the whole run. The per-stage counters are
+// indexed by profile stage; a custom Scheduler may leave them short or nil,
+// which reports the missing stages as zero.
+type SchedulerStats struct {
+	Sent         int64   `json:"sent"`
+	Dropped      int64   `json:"dropped"`
+	Late         int64   `json:"late"`
+	StageSent    []int64 `json:"stage_sent"`
+	StageDropped []int64 `json:"stage_dropped"`
+}
+
+// stageDropped returns the ticks dropped during a stage, zero if the
+// scheduler did not count them
+func (s SchedulerStats) stageDropped(stage int) int64 {
+	if stage >= len(s.StageDropped) {
+		return 0
+	}
+	return s.StageDropped[stage]
+}
+
+// Stats returns a snapshot of the tick counters
+func (s *ArrivalScheduler) Stats() SchedulerStats {
+	stats := SchedulerStats{
+		Sent:         s.sent.Load(),
+		Dropped:      s.dropped.Load(),
+		Late:         s.late.Load(),
+		StageSent:    make([]int64, len(s.stageSent)),
+		StageDropped: make([]int64, len(s.stageDropped)),
+	}
+	for i := range s.stageSent {
+		stats.StageSent[i] = s.stageSent[i].Load()
+		stats.StageDropped[i] = s.stageDropped[i].Load()
+	}
+	return stats
+}
+
+// AddStats adds the counters of a scheduler that ran elsewhere, such as on an
+// agent, to this one
+func (s *ArrivalScheduler) AddStats(stats SchedulerStats) {
+	s.sent.Add(stats.Sent)
+	s.dropped.Add(stats.Dropped)
+	s.late.Add(stats.Late)
+	for i := 0; i < len(s.stageSent) && i < len(stats.StageSent) && i < len(stats.StageDropped); i++ {
+		s.stageSent[i].Add(stats.StageSent[i])
+		s.stageDropped[i].Add(stats.StageDropped[i])
+	}
+}
+
+// acquire takes an in-flight slot for a request sent outside of Run, such as
+// by a virtual user, waiting for one to be free, and counts it as sent
+// during stage
+func (s *ArrivalScheduler) acquire(stage int) {
+	s.slots <- struct{}{}
+	s.sent.Add(1)
+	s.stageSent[stage].Add(1)
+}
+
+// release frees one in-flight slot
+func (s *ArrivalScheduler) release() {
+	<-s.slots
+}
+
+// Profile returns the load profile the scheduler follows
+func (s *ArrivalScheduler) Profile() *Profile {
+	return s.profile
+}
+
+// InFlight returns the number of requests currently outstanding
+func (s *ArrivalScheduler) InFlight() int {
+	return len(s.slots)
+}
+
+// Sent returns the number of ticks handed to a worker so far
+func (s *ArrivalScheduler) Sent() int64 {
+	return s.sent.Load()
+}
+
+// Dropped returns the number of ticks skipped because the in-flight cap was reached
+func (s *ArrivalScheduler) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// StageSent returns the number of ticks handed to a worker during a stage
+func (s *ArrivalScheduler) StageSent(stage int) int64 {
+	return s.stageSent[stage].Load()
+}
+
+// StageDropped returns the number of ticks dropped during a stage
+func (s *ArrivalScheduler) StageDropped(stage int) int64 {
+	return s.stageDropped[stage].Load()
+}
+
+// Late returns the number of ticks that were dispatched behind schedule
+func (s *ArrivalScheduler) Late() int64 {
+	return s.late.Load()
+}
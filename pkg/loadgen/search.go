@@ -0,0 +1,277 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Search finds the highest arrival rate that meets an SLO. It runs one level
+// at a time, each a constant rate held for a while: starting at MinRate it
+// steps the rate up until a level fails, then bisects between the last rate
+// that passed and the first that failed until they are within Precision of
+// each other.
+type Search struct {
+	// Runner runs every level; its Profile, Scheduler, Thresholds, Baseline
+	// and Reporters are replaced for each one, and an Aborter among its
+	// Listeners by one for the level
+	Runner *Runner
+	// SLO a level must meet. A level also fails when it achieves less than
+	// 95% of its rate, as the target or the client could not keep up.
+	SLO *ThresholdSet
+
+	MinRate   float64       // rate of the first level
+	MaxRate   float64       // highest rate tried, unbounded if zero
+	Step      float64       // increase of the rate while stepping up, doubled if zero
+	Hold      time.Duration // length of a level
+	Precision float64       // relative gap between passing and failing rates to stop at, e.g. 0.05
+	MaxLevels int           // cap on the number of levels, 20 if zero
+
+	// Conditions that abort a level, as for NewAborter; checked against the
+	// results of each level alone, aborting the search with it
+	MaxErrors int
+	AbortOn   []string
+
+	OnLevel func(level *SearchLevel) // called after every level, if set
+}
+
+// SearchLevel is the outcome of one level of a search
+type SearchLevel struct {
+	Rate    float64        `json:"rate"`
+	Summary *Summary       `json:"-"`
+	Latency LatencySummary `json:"latency"`
+
+	AchievedRPS        float64  `json:"achieved_rps"`
+	Requests           int      `json:"requests"`
+	ErrorRatePercent   float64  `json:"error_rate_percent"`
+	FailureRatePercent float64  `json:"failure_rate_percent"`
+	Passed             bool     `json:"passed"`
+	Failed             []string `json:"failed,omitempty"` // thresholds not met, as "scope: threshold (actual)"
+	Aborted            string   `json:"aborted,omitempty"`
+}
+
+// SearchResult is the outcome of a search, written to search.json
+type SearchResult struct {
+	MaxRate  float64        `json:"max_rate"` // highest rate that met the SLO, 0 if none did
+	SLO      []string       `json:"slo"`
+	HoldSecs float64        `json:"hold_seconds"`
+	Levels   []*SearchLevel `json:"levels"` // in the order they ran
+	Aborted  string         `json:"aborted,omitempty"`
+}
+
+// Best returns the level of the highest rate that met the SLO, or nil
+func (r *SearchResult) Best() *SearchLevel {
+	var best *SearchLevel
+	for _, level := range r.Levels {
+		if level.Passed && level.Aborted == "" && (best == nil || level.Rate > best.Rate) {
+			best = level
+		}
+	}
+	return best
+}
+
+// Run runs levels until the highest rate that meets the SLO is known, or
+// until ctx is done, which aborts the level in progress. The result holds
+// the levels run so far in either case.
+func (s *Search) Run(ctx context.Context) (*SearchResult, error) {
+	if s.MinRate <= 0 {
+		return nil, errors.New("search: the minimum rate must be positive")
+	}
+	if s.MaxRate > 0 && s.MaxRate < s.MinRate {
+		return nil, errors.New("search: the maximum rate is below the minimum rate")
+	}
+	if s.Hold <= 0 {
+		return nil, errors.New("search: the hold time must be positive")
+	}
+	maxLevels := s.MaxLevels
+	if maxLevels <= 0 {
+		maxLevels = 20
+	}
+	if _, err := NewAborter(func(error) {}, s.MaxErrors, s.AbortOn); err != nil {
+		return nil, err
+	}
+
+	slo := &ThresholdSet{
+		Run:              append([]*Threshold(nil), s.SLO.Run...),
+		EndpointDefaults: s.SLO.EndpointDefaults,
+		Endpoints:        s.SLO.Endpoints,
+	}
+	sustained, _ := ParseThreshold("rps_achieved >= 0.95*target")
+	slo.Run = append(slo.Run, sustained)
+
+	result := &SearchResult{HoldSecs: s.Hold.Seconds()}
+	for _, t := range slo.Run {
+		result.SLO = append(result.SLO, t.Raw)
+	}
+	for _, t := range slo.EndpointDefaults {
+		result.SLO = append(result.SLO, "*: "+t.Raw)
+	}
+	names := make([]string, 0, len(slo.Endpoints))
+	for name := range slo.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, t := range slo.Endpoints[name] {
+			result.SLO = append(result.SLO, name+": "+t.Raw)
+		}
+	}
+
+	// passed is the highest rate that met the SLO, failed the lowest that did
+	// not, zero while unknown
+	var passed, failed float64
+	rate := s.MinRate
+	for len(result.Levels) < maxLevels {
+		level, err := s.runLevel(ctx, rate, slo)
+		if err != nil {
+			return nil, err
+		}
+		result.Levels = append(result.Levels, level)
+		if s.OnLevel != nil {
+			s.OnLevel(level)
+		}
+		if level.Aborted != "" {
+			result.Aborted = level.Aborted
+			break
+		}
+		if level.Passed {
+			passed = rate
+		} else {
+			failed = rate
+		}
+
+		// Step up until a level fails, then bisect
+		switch {
+		case failed == 0 && s.MaxRate > 0 && passed >= s.MaxRate:
+			rate = 0
+		case failed == 0:
+			rate = passed * 2
+			if s.Step > 0 {
+				rate = passed + s.Step
+			}
+			if s.MaxRate > 0 && rate > s.MaxRate {
+				rate = s.MaxRate
+			}
+		case passed == 0 || failed-passed <= math.Max(passed*s.Precision, 0.1):
+			rate = 0
+		default:
+			rate = math.Round((passed+failed)/2*10) / 10
+		}
+		if rate == 0 {
+			break
+		}
+	}
+	result.MaxRate = passed
+	return result, nil
+}
+
+// runLevel runs a single level of the search at rate
+func (s *Search) runLevel(ctx context.Context, rate float64, slo *ThresholdSet) (*SearchLevel, error) {
+	profile := ConstantProfile(rate, s.Hold)
+	if err := profile.Prepare(); err != nil {
+		return nil, err
+	}
+	// Every level checks its abort conditions on its own results
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	aborter, err := NewAborter(cancel, s.MaxErrors, s.AbortOn)
+	if err != nil {
+		return nil, err
+	}
+
+	runner := *s.Runner
+	runner.Profile = profile
+	runner.Scheduler = nil
+	runner.Thresholds = slo
+	runner.Baseline = nil
+	runner.Reporters = nil
+	runner.Listeners = nil
+	for _, listener := range s.Runner.Listeners {
+		if _, ok := listener.(*Aborter); !ok {
+			runner.Listeners = append(runner.Listeners, listener)
+		}
+	}
+	if aborter.Enabled() {
+		runner.Listeners = append(runner.Listeners, aborter)
+	}
+	run, err := runner.Run(ctx)
+	if run == nil {
+		return nil, err
+	}
+
+	summary := run.Summary
+	level := &SearchLevel{
+		Rate:               rate,
+		Summary:            summary,
+		Latency:            summary.Latency,
+		AchievedRPS:        summary.Totals.AchievedRPS,
+		Requests:           summary.Totals.Requests,
+		ErrorRatePercent:   summary.Totals.ErrorRatePercent,
+		FailureRatePercent: summary.Totals.FailureRatePercent,
+		Passed:             run.Passed(),
+		Aborted:            run.Aborted,
+	}
+	for _, r := range run.Thresholds {
+		if !r.Passed {
+			level.Failed = append(level.Failed, fmt.Sprintf("%s: %s (%s)", r.Scope, r.Threshold.Raw, r.Actual))
+		}
+	}
+	return level, nil
+}
+
+// PrintSearchLevel prints a line on a finished level of a search
+func PrintSearchLevel(level *SearchLevel) {
+	verdict := "PASS"
+	switch {
+	case level.Aborted != "":
+		verdict = "ABORTED"
+	case !level.Passed:
+		verdict = "FAIL " + strings.Join(level.Failed, ", ")
+	}
+	fmt.Printf("%10.1f req/s: achieved %.1f req/s, p50 %.2fms, p95 %.2fms, p99 %.2fms, errors %.2f%%  %s\n",
+		level.Rate, level.AchievedRPS, level.Latency.P50Ms, level.Latency.P95Ms, level.Latency.P99Ms, level.ErrorRatePercent, verdict)
+}
+
+// PrintSearch prints the rate against latency curve of a search, by rate, and
+// the highest rate that met the SLO
+func PrintSearch(result *SearchResult) {
+	levels := append([]*SearchLevel(nil), result.Levels...)
+	sort.SliceStable(levels, func(i, j int) bool { return levels[i].Rate < levels[j].Rate })
+
+	fmt.Printf("SLO: %s\n", strings.Join(result.SLO, ", "))
+	fmt.Printf("%-12s%-12s%-12s%-12s%-12s%-12s%-10s%s\n", "Rate", "Achieved", "p50", "p95", "p99", "Max", "Errors", "Result")
+	for _, level := range levels {
+		verdict := "PASS"
+		if level.Aborted != "" {
+			verdict = "ABORTED"
+		} else if !level.Passed {
+			verdict = "FAIL"
+		}
+		fmt.Printf("%-12.1f%-12.1f%-12s%-12s%-12s%-12s%-10s%s\n", level.Rate, level.AchievedRPS,
+			formatMs(level.Latency.P50Ms), formatMs(level.Latency.P95Ms), formatMs(level.Latency.P99Ms), formatMs(level.Latency.MaxMs),
+			fmt.Sprintf("%.2f %%", level.ErrorRatePercent), verdict)
+	}
+	if result.Aborted != "" {
+		fmt.Println("Search aborted:", result.Aborted)
+	}
+	if best := result.Best(); best != nil {
+		fmt.Printf("Highest rate meeting the SLO: %.1f req/s (p99 %s)\n", best.Rate, formatMs(best.Latency.P99Ms))
+	} else {
+		fmt.Println("No rate met the SLO")
+	}
+}
+
+// formatMs formats a latency in milliseconds for the search table
+func formatMs(ms float64) string {
+	return fmt.Sprintf("%.2fms", ms)
+}
+
+// WriteSearch writes the result of a search to search.json in dir
+func WriteSearch(dir string, result *SearchResult) error {
+	return writeJSONFile(filepath.Join(dir, "search.json"), result)
+}
@@ -0,0 +1,216 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that is written as "90s" or "5m" in scenario files
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string such as "1m30s"
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalJSON parses a duration string such as "1m30s"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string such as "1m30s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// MarshalYAML writes the duration as a string such as "1m30s"
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Stage is one segment of a load profile. The arrival rate moves linearly
+// from From to To over Duration; Rate is a shorthand for a constant rate.
+type Stage struct {
+	Name     string   `yaml:"name,omitempty" json:"name"` // name used in the report
+	Duration Duration `yaml:"duration" json:"duration"`   // length of the stage
+	Rate     float64  `yaml:"rate,omitempty" json:"rate"` // constant requests per second
+	From     float64  `yaml:"from,omitempty" json:"from"` // requests per second at the start
+	To       float64  `yaml:"to,omitempty" json:"to"`     // requests per second at the end
+}
+
+// Profile is the sequence of stages that make up a run
+type Profile struct {
+	Stages []Stage
+
+	arrivals []float64 // cumulative number of arrivals at the start of each stage
+}
+
+// ConstantProfile creates a profile with a single stage at a fixed rate
+func ConstantProfile(rate float64, duration time.Duration) *Profile {
+	return &Profile{Stages: []Stage{{Duration: Duration(duration), Rate: rate}}}
+}
+
+// ParseStages parses a comma separated list of stages given on the command
+// line, each written as duration:rate or duration:from-to, for example
+// "60s:10-500,5m:500,10s:2000,30s:500-0"
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		durationText, rateText, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("stage %q: want duration:rate or duration:from-to", part)
+		}
+		duration, err := time.ParseDuration(durationText)
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", part, err)
+		}
+
+		stage := Stage{Duration: Duration(duration)}
+		if fromText, toText, isRamp := strings.Cut(rateText, "-"); isRamp {
+			if stage.From, err = strconv.ParseFloat(fromText, 64); err == nil {
+				stage.To, err = strconv.ParseFloat(toText, 64)
+			}
+		} else {
+			stage.Rate, err = strconv.ParseFloat(rateText, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", part, err)
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// Prepare validates the stages, fills in defaults and precomputes the
+// cumulative arrivals used by the scheduler
+func (p *Profile) Prepare() error {
+	if len(p.Stages) == 0 {
+		return errors.New("profile has no stages")
+	}
+
+	p.arrivals = make([]float64, len(p.Stages)+1)
+	for i := range p.Stages {
+		stage := &p.Stages[i]
+		if stage.Duration <= 0 {
+			return fmt.Errorf("stage %d: duration must be positive", i+1)
+		}
+		if stage.Rate != 0 {
+			stage.From, stage.To = stage.Rate, stage.Rate
+		}
+		if stage.From < 0 || stage.To < 0 {
+			return fmt.Errorf("stage %d: rate must not be negative", i+1)
+		}
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage %d", i+1)
+		}
+		p.arrivals[i+1] = p.arrivals[i] + (stage.From+stage.To)/2*time.Duration(stage.Duration).Seconds()
+	}
+	return nil
+}
+
+// Duration returns the total length of the profile
+func (p *Profile) Duration() time.Duration {
+	var total time.Duration
+	for _, stage := range p.Stages {
+		total += time.Duration(stage.Duration)
+	}
+	return total
+}
+
+// TotalArrivals returns the number of requests the profile schedules
+func (p *Profile) TotalArrivals() int {
+	return int(math.Ceil(p.arrivals[len(p.Stages)]))
+}
+
+// Arrival returns when the k-th request (counting from 0) is due relative to
+// the start of the run, the index of its stage and the rate at that moment.
+// ok is false once the profile has no more arrivals.
+func (p *Profile) Arrival(k int) (offset time.Duration, stageIdx int, rate float64, ok bool) {
+	var stageStart time.Duration
+	for i, stage := range p.Stages {
+		length := time.Duration(stage.Duration)
+		if float64(k) < p.arrivals[i+1] {
+			// Solve arrivals(t) = n for t, where the rate grows linearly from
+			// From to To: arrivals(t) = From*t + (To-From)*t^2/(2*length)
+			n := float64(k) - p.arrivals[i]
+			a := (stage.To - stage.From) / (2 * length.Seconds())
+			b := stage.From
+			var t float64
+			if a == 0 {
+				t = n / b
+			} else {
+				t = (-b + math.Sqrt(b*b+4*a*n)) / (2 * a)
+			}
+			rate = stage.From + 2*a*t
+			return stageStart + time.Duration(t*float64(time.Second)), i, rate, true
+		}
+		stageStart += length
+	}
+	return 0, 0, 0, false
+}
+
+// StageAt returns the index of the stage running at the given offset into the run
+func (p *Profile) StageAt(elapsed time.Duration) int {
+	var end time.Duration
+	for i, stage := range p.Stages {
+		end += time.Duration(stage.Duration)
+		if elapsed < end {
+			return i
+		}
+	}
+	return len(p.Stages) - 1
+}
+
+// StageRan returns how much of stage i a run of the given length got through:
+// the time from the start of the stage to its end or the end of the run,
+// whichever came first, and zero for a stage the run never reached
+func (p *Profile) StageRan(i int, runDuration time.Duration) time.Duration {
+	var start time.Duration
+	for _, stage := range p.Stages[:i] {
+		start += time.Duration(stage.Duration)
+	}
+	end := start + time.Duration(p.Stages[i].Duration)
+	if runDuration < end {
+		end = runDuration
+	}
+	if end < start {
+		return 0
+	}
+	return end - start
+}
+
+// RateAt returns the target arrival rate at the given offset into the run
+func (p *Profile) RateAt(elapsed time.Duration) float64 {
+	var start time.Duration
+	for _, stage := range p.Stages {
+		length := time.Duration(stage.Duration)
+		if elapsed < start+length {
+			progress := float64(elapsed-start) / float64(length)
+			return stage.From + (stage.To-stage.From)*progress
+		}
+		start += length
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Target sends the requests of a scenario. Send renders spec with data and
+// measures the response, storing the values extracted from it in vars. A
+// target is shared by all workers, so Send must be safe for concurrent use.
+type Target interface {
+	Send(ctx context.Context, spec *RequestSpec, data *TemplateData, vars map[string]string) Result
+}
+
+// HTTPTarget sends the requests over HTTP
+type HTTPTarget struct {
+	Client *http.Client // HTTP client to use
+}
+
+// NewHTTPTarget creates a target sending requests with client
+func NewHTTPTarget(client *http.Client) *HTTPTarget {
+	return &HTTPTarget{Client: client}
+}
+
+// Send makes a single request rendered with data and measures its latency
+func (t *HTTPTarget) Send(ctx context.Context, spec *RequestSpec, data *TemplateData, vars map[string]string) Result {
+	result := Result{Name: spec.Name, Method: spec.Method, Start: time.Now()}
+
+	req, err := spec.NewRequest(data)
+	if err != nil {
+		result.Err = &requestError{err}
+		return result
+	}
+	req = req.WithContext(ctx)
+
+	result.URL = req.URL.String()
+
+	trace := &requestTrace{}
+	req = trace.withTrace(req)
+	start := time.Now()
+	resp, err := t.Client.Do(req)
+	var body []byte
+	if err == nil {
+		// Read the body only if an assertion or extractor needs it, otherwise
+		// drain it; either way close it so the connection can be reused
+		if spec.readBody {
+			body, err = io.ReadAll(resp.Body)
+			result.Size = int64(len(body))
+		} else {
+			result.Size, err = io.Copy(io.Discard, resp.Body)
+		}
+		if err != nil {
+			err = &bodyReadError{err}
+		}
+		resp.Body.Close()
+		result.Status = resp.StatusCode
+	}
+	end := time.Now()
+	result.Latency = end.Sub(start)
+	result.Phases = trace.phases(start, end)
+	result.Start = start
+	result.Err = err
+	if err == nil && spec.assert != nil {
+		result.Failures = spec.assert.Check(resp, body, result.Size)
+	}
+	if err == nil && len(spec.Extract) > 0 {
+		result.Failures = append(result.Failures, extract(spec.Extract, resp, body, vars)...)
+	}
+	return result
+}
@@ -0,0 +1,243 @@
+package loadgen
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Template is a request field (path, header value or body) that may contain
+// generator and feeder expressions, e.g. "/book/{{randInt 1 100}}"
+type Template struct {
+	raw  string             // original text
+	tmpl *template.Template // nil when the text contains no expressions
+}
+
+// TemplateData is the per-request context that templates are rendered with.
+// Rows are taken from a feeder the first time it is used in a request, so all
+// the fields of one request see the same row.
+type TemplateData struct {
+	feeders map[string]*Feeder           // feeders declared in the scenario
+	rows    map[string]map[string]string // rows taken for this request
+	vars    map[string]string            // values extracted from earlier responses
+	rng     *mathrand.Rand               // per-worker source for random feeders
+}
+
+// NewTemplateData creates the context for rendering a single request. vars
+// belongs to the worker or virtual user sending it.
+func NewTemplateData(feeders map[string]*Feeder, vars map[string]string, rng *mathrand.Rand) *TemplateData {
+	return &TemplateData{
+		feeders: feeders,
+		rows:    make(map[string]map[string]string),
+		vars:    vars,
+		rng:     rng,
+	}
+}
+
+// Var returns a value extracted from an earlier response
+func (d *TemplateData) Var(name string) (string, error) {
+	value, ok := d.vars[name]
+	if !ok {
+		return "", fmt.Errorf("variable %q is not set", name)
+	}
+	return value, nil
+}
+
+// Feed returns a column of the current row of the named feeder
+func (d *TemplateData) Feed(name, column string) (string, error) {
+	row, ok := d.rows[name]
+	if !ok {
+		feeder, ok := d.feeders[name]
+		if !ok {
+			return "", fmt.Errorf("unknown feeder %q", name)
+		}
+		row = feeder.Next(d.rng)
+		d.rows[name] = row
+	}
+	value, ok := row[column]
+	if !ok {
+		return "", fmt.Errorf("feeder %q has no column %q", name, column)
+	}
+	return value, nil
+}
+
+// Generators holds the state shared by the built-in template functions
+type Generators struct {
+	sequences sync.Map // sequence name -> *atomic.Int64
+}
+
+// Funcs returns the built-in generator functions:
+//
+//	seq [name]             next value of a counter starting at 1
+//	randInt min max        random integer in [min, max]
+//	randString n           random string of n letters
+//	uuid                   random version 4 UUID
+//	timestamp [layout]     current unix time, or the time formatted with layout
+func (g *Generators) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"seq":        g.seq,
+		"randInt":    randInt,
+		"randString": randString,
+		"uuid":       newUUID,
+		"timestamp":  timestamp,
+	}
+}
+
+func (g *Generators) seq(name ...string) int64 {
+	key := strings.Join(name, "")
+	counter, _ := g.sequences.LoadOrStore(key, &atomic.Int64{})
+	return counter.(*atomic.Int64).Add(1)
+}
+
+func randInt(min, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("randInt: max %d is less than min %d", max, min)
+	}
+	return min + mathrand.Intn(max-min+1), nil
+}
+
+const randStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func randString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randStringLetters[mathrand.Intn(len(randStringLetters))]
+	}
+	return string(b)
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func timestamp(layout ...string) string {
+	now := time.Now()
+	if len(layout) == 0 {
+		return fmt.Sprint(now.Unix())
+	}
+	return now.Format(layout[0])
+}
+
+// ParseTemplate compiles text using the given generator functions
+func ParseTemplate(name, text string, funcs template.FuncMap) (*Template, error) {
+	t := &Template{raw: text}
+	if !strings.Contains(text, "{{") {
+		return t, nil
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// Render executes the template for a single request
+func (t *Template) Render(data *TemplateData) (string, error) {
+	if t.tmpl == nil {
+		return t.raw, nil
+	}
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// isSingleExpression reports whether the template is exactly one {{...}} action
+func (t *Template) isSingleExpression() bool {
+	if t.tmpl == nil {
+		return false
+	}
+	text := strings.TrimSpace(t.raw)
+	return strings.HasPrefix(text, "{{") && strings.HasSuffix(text, "}}") && strings.Count(text, "{{") == 1
+}
+
+// compileValue replaces every string in a decoded YAML/JSON body with a
+// Template, so structured bodies can use expressions in their values. A value
+// that consists of a single expression and renders to a number or boolean is
+// sent as that JSON type, e.g. author_id: "{{.Feed \"authors\" \"id\"}}"; add
+// any literal text around the expression to always send a string.
+func compileValue(name string, v interface{}, funcs template.FuncMap) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return ParseTemplate(name, v, funcs)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			compiled, err := compileValue(name+"."+k, item, funcs)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = compiled
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			compiled, err := compileValue(fmt.Sprintf("%s[%d]", name, i), item, funcs)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = compiled
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// renderValue renders a value produced by compileValue
+func renderValue(v interface{}, data *TemplateData) (interface{}, error) {
+	switch v := v.(type) {
+	case *Template:
+		rendered, err := v.Render(data)
+		if err != nil {
+			return nil, err
+		}
+		if v.isSingleExpression() {
+			var literal interface{}
+			if err := json.Unmarshal([]byte(rendered), &literal); err == nil {
+				switch literal.(type) {
+				case float64, bool:
+					return json.RawMessage(rendered), nil
+				}
+			}
+		}
+		return rendered, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			rendered, err := renderValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,309 @@
+package loadgen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Threshold is a pass/fail condition on a metric of the run or of an endpoint,
+// written as "<metric> <op> <value>", for example
+//
+//	p95 < 200ms
+//	error_rate < 1%
+//	rps_achieved > 0.95*target
+//
+// Latency metrics are min, mean (or avg), p50, p90, p95, p99, p99.9 and max;
+// the others are error_rate (percent of requests that returned an error or a
+// 5xx status) and failure_rate (percent of requests failing assertions),
+// rps_achieved (or rps), requests, errors and failed.
+type Threshold struct {
+	Raw      string  // expression as written
+	Metric   string  // metric name
+	Op       string  // one of <, <=, >, >=
+	Value    float64 // limit, in milliseconds for latency metrics
+	OfTarget bool    // Value is a fraction of the target rate
+}
+
+// thresholdOps lists the comparison operators, longest first so "<=" is not read as "<"
+var thresholdOps = []string{"<=", ">=", "<", ">"}
+
+// latencyMetrics maps latency metric names to their value in a LatencySummary
+var latencyMetrics = map[string]func(LatencySummary) float64{
+	"min":   func(l LatencySummary) float64 { return l.MinMs },
+	"mean":  func(l LatencySummary) float64 { return l.MeanMs },
+	"avg":   func(l LatencySummary) float64 { return l.MeanMs },
+	"p50":   func(l LatencySummary) float64 { return l.P50Ms },
+	"p90":   func(l LatencySummary) float64 { return l.P90Ms },
+	"p95":   func(l LatencySummary) float64 { return l.P95Ms },
+	"p99":   func(l LatencySummary) float64 { return l.P99Ms },
+	"p99.9": func(l LatencySummary) float64 { return l.P999Ms },
+	"max":   func(l LatencySummary) float64 { return l.MaxMs },
+}
+
+// ParseThreshold parses a threshold expression
+func ParseThreshold(expr string) (*Threshold, error) {
+	t := &Threshold{Raw: strings.TrimSpace(expr)}
+
+	var metric, value string
+	for _, op := range thresholdOps {
+		if i := strings.Index(t.Raw, op); i >= 0 {
+			t.Op = op
+			metric, value = strings.TrimSpace(t.Raw[:i]), strings.TrimSpace(t.Raw[i+len(op):])
+			break
+		}
+	}
+	if t.Op == "" {
+		return nil, fmt.Errorf("threshold %q: missing comparison operator", expr)
+	}
+	t.Metric = strings.ToLower(metric)
+	if t.Metric == "rps" {
+		t.Metric = "rps_achieved"
+	}
+
+	var err error
+	switch {
+	case latencyMetrics[t.Metric] != nil:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil {
+			t.Value = durationMs(d)
+		}
+	case t.Metric == "error_rate" || t.Metric == "failure_rate":
+		t.Value, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	case t.Metric == "rps_achieved":
+		if fraction, ok := strings.CutSuffix(value, "target"); ok {
+			t.OfTarget = true
+			fraction = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fraction), "*"))
+			t.Value = 1
+			if fraction != "" {
+				t.Value, err = strconv.ParseFloat(fraction, 64)
+			}
+		} else {
+			t.Value, err = strconv.ParseFloat(value, 64)
+		}
+	case t.Metric == "requests" || t.Metric == "errors" || t.Metric == "failed":
+		t.Value, err = strconv.ParseFloat(value, 64)
+	default:
+		return nil, fmt.Errorf("threshold %q: unknown metric %q", expr, metric)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("threshold %q: invalid value %q: %w", expr, value, err)
+	}
+	return t, nil
+}
+
+// Evaluate checks the threshold against a group of results, returning the
+// actual value formatted for display and whether the threshold passed
+func (t *Threshold) Evaluate(group *GroupSummary) (string, bool) {
+	var actual, limit float64
+	var display string
+
+	limit = t.Value
+	switch {
+	case latencyMetrics[t.Metric] != nil:
+		actual = latencyMetrics[t.Metric](group.Latency)
+		display = time.Duration(actual * float64(time.Millisecond)).String()
+	case t.Metric == "error_rate":
+		actual = group.ErrorRatePercent
+		display = fmt.Sprintf("%.2f%%", actual)
+	case t.Metric == "failure_rate":
+		actual = group.FailureRatePercent
+		display = fmt.Sprintf("%.2f%%", actual)
+	case t.Metric == "rps_achieved":
+		actual = group.RPS
+		display = fmt.Sprintf("%.2f", actual)
+		if t.OfTarget {
+			limit = t.Value * group.TargetRPS
+			display = fmt.Sprintf("%.2f (limit %.2f)", actual, limit)
+		}
+	case t.Metric == "requests":
+		actual = float64(group.Requests)
+		display = fmt.Sprint(group.Requests)
+	case t.Metric == "errors":
+		actual = float64(group.Errors)
+		display = fmt.Sprint(group.Errors)
+	case t.Metric == "failed":
+		actual = float64(group.Failed)
+		display = fmt.Sprint(group.Failed)
+	}
+
+	switch t.Op {
+	case "<":
+		return display, actual < limit
+	case "<=":
+		return display, actual <= limit
+	case ">":
+		return display, actual > limit
+	default:
+		return display, actual >= limit
+	}
+}
+
+// ThresholdSet holds the thresholds of a run. Endpoint defaults apply to
+// every endpoint, except for metrics that the endpoint sets itself.
+type ThresholdSet struct {
+	Run              []*Threshold            // checked against the totals of the run
+	EndpointDefaults []*Threshold            // checked against every endpoint
+	Endpoints        map[string][]*Threshold // checked against a single endpoint
+}
+
+// ThresholdResult is the outcome of a single threshold
+type ThresholdResult struct {
+	Scope     string // "run" or the endpoint name
+	Threshold *Threshold
+	Actual    string
+	Passed    bool
+}
+
+// NewThresholdSet creates an empty set of thresholds
+func NewThresholdSet() *ThresholdSet {
+	return &ThresholdSet{Endpoints: make(map[string][]*Threshold)}
+}
+
+// Add parses expr and adds it for the given scope: "" for the run, "*" for
+// every endpoint, or an endpoint name
+func (ts *ThresholdSet) Add(scope, expr string) error {
+	t, err := ParseThreshold(expr)
+	if err != nil {
+		return err
+	}
+	switch scope {
+	case "":
+		ts.Run = append(ts.Run, t)
+	case "*":
+		ts.EndpointDefaults = append(ts.EndpointDefaults, t)
+	default:
+		ts.Endpoints[scope] = append(ts.Endpoints[scope], t)
+	}
+	return nil
+}
+
+// AddFlag adds a threshold given on the command line as "expr" for the run,
+// "*: expr" for every endpoint or "<endpoint name>: expr"
+func (ts *ThresholdSet) AddFlag(value string) error {
+	// Expressions never contain a colon, so the last one ends the scope
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		return ts.Add(strings.TrimSpace(value[:i]), value[i+1:])
+	}
+	return ts.Add("", value)
+}
+
+// Empty reports whether the set has no thresholds
+func (ts *ThresholdSet) Empty() bool {
+	return len(ts.Run) == 0 && len(ts.EndpointDefaults) == 0 && len(ts.Endpoints) == 0
+}
+
+// Evaluate checks all thresholds against the summary of a run
+func (ts *ThresholdSet) Evaluate(summary *Summary) []ThresholdResult {
+	var results []ThresholdResult
+
+	run := &GroupSummary{
+		Name:               "run",
+		Requests:           summary.Totals.Requests,
+		Errors:             summary.Totals.Errors,
+		ErrorRatePercent:   summary.Totals.ErrorRatePercent,
+		Failed:             summary.Totals.Failed,
+		FailureRatePercent: summary.Totals.FailureRatePercent,
+		RPS:                summary.Totals.AchievedRPS,
+		TargetRPS:          summary.Totals.TargetRPS,
+		Latency:            summary.Latency,
+	}
+	for _, t := range ts.Run {
+		actual, passed := t.Evaluate(run)
+		results = append(results, ThresholdResult{"run", t, actual, passed})
+	}
+
+	// Endpoints named in thresholds but never requested fail on every threshold
+	names := make(map[string]bool)
+	for name := range summary.Endpoints {
+		names[name] = true
+	}
+	for name := range ts.Endpoints {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		group, ok := summary.Endpoints[name]
+		for _, t := range ts.endpointThresholds(name) {
+			if !ok {
+				results = append(results, ThresholdResult{name, t, "no requests", false})
+				continue
+			}
+			actual, passed := t.Evaluate(group)
+			results = append(results, ThresholdResult{name, t, actual, passed})
+		}
+	}
+	return results
+}
+
+// endpointThresholds returns the endpoint's own thresholds followed by the
+// defaults for metrics it does not set
+func (ts *ThresholdSet) endpointThresholds(name string) []*Threshold {
+	own := ts.Endpoints[name]
+	thresholds := append([]*Threshold{}, own...)
+	for _, def := range ts.EndpointDefaults {
+		overridden := false
+		for _, t := range own {
+			if t.Metric == def.Metric {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			thresholds = append(thresholds, def)
+		}
+	}
+	return thresholds
+}
+
+// thresholdSummaries converts threshold results for summary.json
+func thresholdSummaries(results []ThresholdResult) []ThresholdSummary {
+	summaries := make([]ThresholdSummary, 0, len(results))
+	for _, r := range results {
+		summaries = append(summaries, ThresholdSummary{r.Scope, r.Threshold.Raw, r.Actual, r.Passed})
+	}
+	return summaries
+}
+
+// thresholdChecks converts threshold results into JUnit checks
+func thresholdChecks(results []ThresholdResult) []Check {
+	checks := make([]Check, 0, len(results))
+	for _, r := range results {
+		checks = append(checks, Check{
+			Name:    r.Threshold.Raw,
+			Group:   "thresholds." + r.Scope,
+			Passed:  r.Passed,
+			Message: fmt.Sprintf("%s: %s, actual %s", r.Scope, r.Threshold.Raw, r.Actual),
+		})
+	}
+	return checks
+}
+
+// printThresholds prints the pass/fail table and reports whether all passed
+func printThresholds(results []ThresholdResult) bool {
+	width := len("Scope") + 2
+	for _, r := range results {
+		if len(r.Scope)+2 > width {
+			width = len(r.Scope) + 2
+		}
+	}
+
+	allPassed := true
+	fmt.Printf("%-*s%-32s%-28s%s\n", width, "Scope", "Threshold", "Actual", "Result")
+	for _, r := range results {
+		verdict := "PASS"
+		if !r.Passed {
+			verdict = "FAIL"
+			allPassed = false
+		}
+		fmt.Printf("%-*s%-32s%-28s%s\n", width, r.Scope, r.Threshold.Raw, r.Actual, verdict)
+	}
+	return allPassed
+}
@@ -0,0 +1,128 @@
+package loadgen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Threshold // Raw is the trimmed expression
+	}{
+		// Latency metrics take a duration, kept in milliseconds
+		{"p95 < 200ms", Threshold{Metric: "p95", Op: "<", Value: 200}},
+		{"p99 <= 1.5s", Threshold{Metric: "p99", Op: "<=", Value: 1500}},
+		{"p50 < 250us", Threshold{Metric: "p50", Op: "<", Value: 0.25}},
+		{"max < 2m", Threshold{Metric: "max", Op: "<", Value: 120000}},
+		{"p99.9 < 1s", Threshold{Metric: "p99.9", Op: "<", Value: 1000}},
+		{"  AVG<10ms  ", Threshold{Metric: "avg", Op: "<", Value: 10}},
+		{"min >= 1ms", Threshold{Metric: "min", Op: ">=", Value: 1}},
+
+		// Rates are percentages, with or without the sign
+		{"error_rate < 1%", Threshold{Metric: "error_rate", Op: "<", Value: 1}},
+		{"error_rate <= 0.5", Threshold{Metric: "error_rate", Op: "<=", Value: 0.5}},
+		{"failure_rate <= 0", Threshold{Metric: "failure_rate", Op: "<=", Value: 0}},
+
+		// The achieved rate is absolute or a fraction of the target
+		{"rps_achieved > 100", Threshold{Metric: "rps_achieved", Op: ">", Value: 100}},
+		{"rps > 0.95*target", Threshold{Metric: "rps_achieved", Op: ">", Value: 0.95, OfTarget: true}},
+		{"rps_achieved >= 0.9 * target", Threshold{Metric: "rps_achieved", Op: ">=", Value: 0.9, OfTarget: true}},
+		{"rps >= target", Threshold{Metric: "rps_achieved", Op: ">=", Value: 1, OfTarget: true}},
+
+		// Counts
+		{"requests >= 1000", Threshold{Metric: "requests", Op: ">=", Value: 1000}},
+		{"errors <= 5", Threshold{Metric: "errors", Op: "<=", Value: 5}},
+		{"failed < 1", Threshold{Metric: "failed", Op: "<", Value: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ParseThreshold(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			want.Raw = strings.TrimSpace(tt.expr)
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("parsed %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestParseThresholdErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"missing operator", "p95 200ms"},
+		{"equals", "p95 = 200ms"},
+		{"not equal", "p95 != 200ms"},
+		{"reversed operator", "p95 => 200ms"},
+		{"doubled operator", "p95 < < 200ms"},
+		{"mixed operator", "p95 <> 200ms"},
+		{"missing value", "p95 <"},
+		{"missing metric", "< 200ms"},
+		{"unknown metric", "p42 < 200ms"},
+		{"latency without unit", "p95 < 200"},
+		{"latency of target", "p95 < 0.5*target"},
+		{"rate with unit", "error_rate < 1ms"},
+		{"bad target fraction", "rps > x*target"},
+		{"count with unit", "requests > 10k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := ParseThreshold(tt.expr); err == nil {
+				t.Errorf("parsed %q as %+v, want an error", tt.expr, *got)
+			}
+		})
+	}
+}
+
+func TestThresholdSetAddFlag(t *testing.T) {
+	tests := []struct {
+		flag   string
+		scope  string // "" for the run, "*" for every endpoint
+		metric string
+	}{
+		{"p95 < 200ms", "", "p95"},
+		{"*: error_rate < 1%", "*", "error_rate"},
+		{"*:p99 < 1s", "*", "p99"},
+		{"list books: p95 < 200ms", "list books", "p95"},
+		{"  list books  :  p95 < 200ms", "list books", "p95"},
+		// Names may contain colons; the expression follows the last one
+		{"GET http://localhost:9011/books: p95 < 200ms", "GET http://localhost:9011/books", "p95"},
+		{"auth: login: rps > 0.9*target", "auth: login", "rps_achieved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			ts := NewThresholdSet()
+			if err := ts.AddFlag(tt.flag); err != nil {
+				t.Fatal(err)
+			}
+			var added []*Threshold
+			switch tt.scope {
+			case "":
+				added = ts.Run
+			case "*":
+				added = ts.EndpointDefaults
+			default:
+				added = ts.Endpoints[tt.scope]
+			}
+			if len(added) != 1 || added[0].Metric != tt.metric {
+				t.Fatalf("run %v, defaults %v, endpoints %v; want %s in scope %q", ts.Run, ts.EndpointDefaults, ts.Endpoints, tt.metric, tt.scope)
+			}
+			total := len(ts.Run) + len(ts.EndpointDefaults) + len(ts.Endpoints)
+			if total != 1 {
+				t.Errorf("added %d thresholds, want 1", total)
+			}
+		})
+	}
+
+	for _, flag := range []string{"list books: p95 200ms", "list books: p95 < 200", "books: p42 < 1s", "p95 < 200ms:"} {
+		if err := NewThresholdSet().AddFlag(flag); err == nil {
+			t.Errorf("added %q without an error", flag)
+		}
+	}
+}
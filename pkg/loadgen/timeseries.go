@@ -0,0 +1,173 @@
+package loadgen
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeSeriesColumns are the columns of the CSV time series
+var timeSeriesColumns = []string{
+	"time", "elapsed_s", "interval_s", "scope", "stage", "requests", "errors", "failed", "rps", "status",
+	"min_ms", "mean_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms", "p99_9_ms", "max_ms", "in_flight", "ticks_dropped",
+}
+
+// TimeSeriesPoint is the metrics of the run or of one endpoint over one interval
+type TimeSeriesPoint struct {
+	Time            time.Time      `json:"time"`             // end of the interval
+	ElapsedSeconds  float64        `json:"elapsed_seconds"`  // time since the start of the run
+	IntervalSeconds float64        `json:"interval_seconds"` // length of the interval
+	Scope           string         `json:"scope"`            // "run" or the endpoint name
+	Stage           string         `json:"stage"`            // stage the interval ended in
+	Requests        int            `json:"requests"`
+	Errors          int            `json:"errors"`
+	Failed          int            `json:"failed"` // responses that failed an assertion
+	RPS             float64        `json:"rps"`
+	Status          map[string]int `json:"status"` // requests per status code
+	Latency         LatencySummary `json:"latency"`
+	InFlight        int            `json:"in_flight,omitempty"`     // run only
+	Dropped         int64          `json:"ticks_dropped,omitempty"` // run only
+}
+
+// TimeSeries writes the metrics of every interval to a CSV or JSONL file, one
+// line for the run followed by one line per endpoint
+type TimeSeries struct {
+	profile *Profile
+	file    *os.File
+	buf     *bufio.Writer
+	csv     *csv.Writer   // set for the csv format
+	encoder *json.Encoder // set for the jsonl format
+	err     error         // first write error
+}
+
+// NewTimeSeries creates the time series file at path in the given format (csv or jsonl)
+func NewTimeSeries(path, format string, profile *Profile) (*TimeSeries, error) {
+	if format != "csv" && format != "jsonl" {
+		return nil, fmt.Errorf("unknown time series format %q, want csv or jsonl", format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &TimeSeries{profile: profile, file: file, buf: bufio.NewWriter(file)}
+	if format == "csv" {
+		ts.csv = csv.NewWriter(ts.buf)
+		ts.csv.Write(timeSeriesColumns)
+	} else {
+		ts.encoder = json.NewEncoder(ts.buf)
+	}
+	return ts, nil
+}
+
+// OnInterval writes the points of a window
+func (ts *TimeSeries) OnInterval(w *Window) {
+	end := w.Start.Add(w.Length)
+	stage := ts.profile.Stages[w.Stage].Name
+
+	run := newTimeSeriesPoint(end, w, "run", stage, w.Metrics)
+	run.InFlight = w.InFlight
+	run.Dropped = w.Dropped
+	ts.write(run)
+
+	names := make([]string, 0, len(w.Metrics.Endpoints))
+	for name := range w.Metrics.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ts.write(newTimeSeriesPoint(end, w, name, stage, w.Metrics.Endpoints[name]))
+	}
+}
+
+// newTimeSeriesPoint summarises the metrics of one scope in a window
+func newTimeSeriesPoint(end time.Time, w *Window, scope, stage string, m *Metrics) *TimeSeriesPoint {
+	p := &TimeSeriesPoint{
+		Time:            end,
+		ElapsedSeconds:  w.Elapsed.Seconds(),
+		IntervalSeconds: w.Length.Seconds(),
+		Scope:           scope,
+		Stage:           stage,
+		Requests:        m.Requests,
+		Errors:          m.Errors,
+		Failed:          m.Failed,
+		RPS:             w.rate(m.Requests),
+		Status:          make(map[string]int),
+		Latency:         NewLatencySummary(m.Latency),
+	}
+	for code, sm := range m.Status {
+		if sm.Count > 0 {
+			p.Status[strconv.Itoa(code)] = sm.Count
+		}
+	}
+	return p
+}
+
+// write appends a point to the file, keeping the first error for Close
+func (ts *TimeSeries) write(p *TimeSeriesPoint) {
+	if ts.err != nil {
+		return
+	}
+	if ts.encoder != nil {
+		ts.err = ts.encoder.Encode(p)
+		return
+	}
+
+	// Status counts go in a single column as "200=95 500=5"
+	codes := make([]string, 0, len(p.Status))
+	for code := range p.Status {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for i, code := range codes {
+		codes[i] = code + "=" + strconv.Itoa(p.Status[code])
+	}
+
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	ts.err = ts.csv.Write([]string{
+		p.Time.Format(time.RFC3339Nano),
+		f(p.ElapsedSeconds),
+		f(p.IntervalSeconds),
+		p.Scope,
+		p.Stage,
+		strconv.Itoa(p.Requests),
+		strconv.Itoa(p.Errors),
+		strconv.Itoa(p.Failed),
+		f(p.RPS),
+		strings.Join(codes, " "),
+		f(p.Latency.MinMs),
+		f(p.Latency.MeanMs),
+		f(p.Latency.P50Ms),
+		f(p.Latency.P90Ms),
+		f(p.Latency.P95Ms),
+		f(p.Latency.P99Ms),
+		f(p.Latency.P999Ms),
+		f(p.Latency.MaxMs),
+		strconv.Itoa(p.InFlight),
+		strconv.FormatInt(p.Dropped, 10),
+	})
+}
+
+// Close flushes the time series and closes the file, returning the first
+// error met while writing
+func (ts *TimeSeries) Close() error {
+	if ts.csv != nil {
+		ts.csv.Flush()
+		if ts.err == nil {
+			ts.err = ts.csv.Error()
+		}
+	}
+	if err := ts.buf.Flush(); err != nil && ts.err == nil {
+		ts.err = err
+	}
+	if err := ts.file.Close(); err != nil && ts.err == nil {
+		ts.err = err
+	}
+	return ts.err
+}
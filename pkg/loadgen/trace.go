@@ -0,0 +1,174 @@
+package loadgen
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phaseNames are the connection phases of a request, in the order they happen
+var phaseNames = []string{"dns", "connect", "tls", "ttfb", "transfer"}
+
+// Phases is the timing breakdown of a single request. DNS, Connect and TLS are
+// only set when the request opened a new connection.
+type Phases struct {
+	DNS      time.Duration // resolving the host name
+	Connect  time.Duration // establishing the TCP connection
+	TLS      time.Duration // TLS handshake
+	TTFB     time.Duration // from sending the request to the first response byte
+	Transfer time.Duration // from the first response byte to the end of the body
+	Reused   bool          // the request was sent on a kept-alive connection
+	traced   bool          // the request got as far as a connection
+}
+
+// requestTrace records the phase timestamps of one request. The hooks may be
+// called from different goroutines, so they are serialised with a mutex.
+type requestTrace struct {
+	mu                        sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	gotConn, firstByte        time.Time
+	reused                    bool
+}
+
+// withTrace returns the request with a trace attached that records into t
+func (t *requestTrace) withTrace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		// Dialing may try several addresses; keep the first start and last end
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone:          func(string, string, error) { t.set(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// set stores the current time in one of the timestamps
+func (t *requestTrace) set(ts *time.Time) {
+	now := time.Now()
+	t.mu.Lock()
+	*ts = now
+	t.mu.Unlock()
+}
+
+// phases computes the breakdown of a request sent at start whose body was
+// read by end
+func (t *requestTrace) phases(start, end time.Time) Phases {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := Phases{Reused: t.reused, traced: !t.gotConn.IsZero()}
+	if !t.dnsStart.IsZero() && !t.dnsDone.IsZero() {
+		p.DNS = t.dnsDone.Sub(t.dnsStart)
+	}
+	if !t.connectStart.IsZero() && !t.connectDone.IsZero() {
+		p.Connect = t.connectDone.Sub(t.connectStart)
+	}
+	if !t.tlsStart.IsZero() && !t.tlsDone.IsZero() {
+		p.TLS = t.tlsDone.Sub(t.tlsStart)
+	}
+	if !t.firstByte.IsZero() {
+		// Time to first byte counts from when the request went out on the connection
+		sent := start
+		if t.gotConn.After(sent) {
+			sent = t.gotConn
+		}
+		p.TTFB = t.firstByte.Sub(sent)
+		p.Transfer = end.Sub(t.firstByte)
+	}
+	return p
+}
+
+// PhaseMetrics aggregates the connection phases of requests
+type PhaseMetrics struct {
+	DNS         *Histogram // only requests that resolved a name
+	Connect     *Histogram // only requests that opened a connection
+	TLS         *Histogram // only requests that made a TLS handshake
+	TTFB        *Histogram
+	Transfer    *Histogram
+	Reused      int // requests sent on a kept-alive connection
+	Connections int // requests that got a connection at all
+}
+
+// NewPhaseMetrics creates empty phase metrics
+func NewPhaseMetrics() *PhaseMetrics {
+	return &PhaseMetrics{
+		DNS:      NewHistogram(),
+		Connect:  NewHistogram(),
+		TLS:      NewHistogram(),
+		TTFB:     NewHistogram(),
+		Transfer: NewHistogram(),
+	}
+}
+
+// Record adds the phases of one request
+func (m *PhaseMetrics) Record(p Phases) {
+	if !p.traced {
+		return
+	}
+	m.Connections++
+	if p.Reused {
+		m.Reused++
+	} else {
+		if p.DNS > 0 {
+			m.DNS.Record(p.DNS)
+		}
+		if p.Connect > 0 {
+			m.Connect.Record(p.Connect)
+		}
+		if p.TLS > 0 {
+			m.TLS.Record(p.TLS)
+		}
+	}
+	m.TTFB.Record(p.TTFB)
+	m.Transfer.Record(p.Transfer)
+}
+
+// Merge adds the phases recorded in other
+func (m *PhaseMetrics) Merge(other *PhaseMetrics) {
+	for i, h := range m.histograms() {
+		h.Merge(other.histograms()[i])
+	}
+	m.Reused += other.Reused
+	m.Connections += other.Connections
+}
+
+// Reset clears the phase metrics so they can be reused
+func (m *PhaseMetrics) Reset() {
+	for _, h := range m.histograms() {
+		h.Reset()
+	}
+	m.Reused = 0
+	m.Connections = 0
+}
+
+// histograms returns the phase histograms in the order of phaseNames
+func (m *PhaseMetrics) histograms() []*Histogram {
+	return []*Histogram{m.DNS, m.Connect, m.TLS, m.TTFB, m.Transfer}
+}
+
+// ReusePercent returns the share of requests sent on a kept-alive connection
+func (m *PhaseMetrics) ReusePercent() float64 {
+	if m.Connections == 0 {
+		return 0
+	}
+	return float64(m.Reused) / float64(m.Connections) * 100
+}
@@ -0,0 +1,132 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP/2 modes of the transport
+const (
+	http2Auto = "auto" // negotiated with the server over TLS, HTTP/1.1 otherwise
+	http2Off  = "off"  // always HTTP/1.1
+	http2H2C  = "h2c"  // HTTP/2 over cleartext with prior knowledge, for servers without TLS
+)
+
+// TransportConfig holds the options of the HTTP client that sends the
+// requests. The zero values of the limits keep the net/http defaults.
+type TransportConfig struct {
+	KeepAlive           bool          `json:"keep_alive"`                        // reuse connections between requests
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host,omitempty"` // idle connections kept per host
+	MaxConnsPerHost     int           `json:"max_conns_per_host,omitempty"`      // cap on connections per host
+	Timeout             time.Duration `json:"timeout"`                           // per-request timeout, body included
+	HTTP2               string        `json:"http2"`                             // auto, off or h2c
+	Insecure            bool          `json:"insecure,omitempty"`                // skip TLS certificate verification
+	CACert              string        `json:"ca_cert,omitempty"`                 // PEM file of CAs to trust instead of the system ones
+	ClientCert          string        `json:"client_cert,omitempty"`             // PEM certificate for TLS client authentication
+	ClientKey           string        `json:"client_key,omitempty"`              // PEM key of ClientCert
+	Proxy               string        `json:"proxy,omitempty"`                   // proxy url, from the environment if empty
+	DisableCompression  bool          `json:"disable_compression,omitempty"`     // do not ask for gzip responses
+}
+
+// NewClient creates the HTTP client described by the configuration
+func (c *TransportConfig) NewClient() (*http.Client, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.HTTP2 {
+	case http2Auto, http2Off:
+	case http2H2C:
+		return c.h2cClient()
+	default:
+		return nil, fmt.Errorf("unknown http2 mode %q, want auto, off or h2c", c.HTTP2)
+	}
+
+	// Start from the default transport so its dial and handshake timeouts are kept
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DisableKeepAlives = !c.KeepAlive
+	transport.DisableCompression = c.DisableCompression
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < c.MaxIdleConnsPerHost {
+			transport.MaxIdleConns = c.MaxIdleConnsPerHost
+		}
+	}
+	transport.MaxConnsPerHost = c.MaxConnsPerHost
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if c.HTTP2 == http2Off {
+		// A non-nil empty map turns off the HTTP/2 upgrade during the TLS handshake
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return &http.Client{Transport: transport, Timeout: c.Timeout}, nil
+}
+
+// h2cClient creates a client speaking HTTP/2 without TLS. Such connections
+// are always multiplexed, so keep-alive, the connection limits and a proxy
+// cannot be set.
+func (c *TransportConfig) h2cClient() (*http.Client, error) {
+	switch {
+	case !c.KeepAlive:
+		return nil, errors.New("h2c cannot be combined with keep-alive off")
+	case c.MaxIdleConnsPerHost > 0 || c.MaxConnsPerHost > 0:
+		return nil, errors.New("h2c cannot be combined with connection limits")
+	case c.Proxy != "":
+		return nil, errors.New("h2c cannot be combined with a proxy")
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := &http2.Transport{
+		AllowHTTP:          true,
+		DisableCompression: c.DisableCompression,
+		// Dial a plain TCP connection where an https url would start a handshake
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	return &http.Client{Transport: transport, Timeout: c.Timeout}, nil
+}
+
+// tlsConfig builds the TLS settings from the certificate options
+func (c *TransportConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.Insecure}
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CACert)
+		}
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return nil, errors.New("a client certificate needs both a certificate and a key file")
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
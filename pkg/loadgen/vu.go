@@ -0,0 +1,310 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ThinkTime is the pause a virtual user takes between two requests, written
+// as "constant:1s" (or just "1s"), "uniform:500ms-2s" or "exponential:1s",
+// where the exponential value is the mean
+type ThinkTime struct {
+	Distribution string        // constant, uniform or exponential
+	Min          time.Duration // constant value, lower bound or mean
+	Max          time.Duration // upper bound of the uniform distribution
+}
+
+// ParseThinkTime parses a think time such as "uniform:500ms-2s"
+func ParseThinkTime(s string) (*ThinkTime, error) {
+	distribution, value, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		distribution, value = "constant", distribution
+	}
+	t := &ThinkTime{Distribution: strings.ToLower(distribution)}
+
+	var err error
+	switch t.Distribution {
+	case "constant", "exponential":
+		t.Min, err = time.ParseDuration(value)
+	case "uniform":
+		minText, maxText, ok := strings.Cut(value, "-")
+		if !ok {
+			return nil, fmt.Errorf("think time %q: want uniform:min-max", s)
+		}
+		if t.Min, err = time.ParseDuration(minText); err == nil {
+			t.Max, err = time.ParseDuration(maxText)
+		}
+		if err == nil && t.Max < t.Min {
+			err = errors.New("max is below min")
+		}
+	default:
+		return nil, fmt.Errorf("think time %q: unknown distribution %q, want constant, uniform or exponential", s, distribution)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("think time %q: %w", s, err)
+	}
+	if t.Min < 0 {
+		return nil, fmt.Errorf("think time %q: must not be negative", s)
+	}
+	return t, nil
+}
+
+// UnmarshalYAML parses a think time string
+func (t *ThinkTime) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := ParseThinkTime(value.Value)
+	if err != nil {
+		return err
+	}
+	*t = *parsed
+	return nil
+}
+
+// UnmarshalJSON parses a think time string
+func (t *ThinkTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseThinkTime(s)
+	if err != nil {
+		return err
+	}
+	*t = *parsed
+	return nil
+}
+
+// MarshalJSON writes the think time in the form it is parsed from
+func (t *ThinkTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// MarshalYAML writes the think time in the form it is parsed from
+func (t *ThinkTime) MarshalYAML() (interface{}, error) {
+	return t.String(), nil
+}
+
+func (t *ThinkTime) String() string {
+	if t.Distribution == "uniform" {
+		return fmt.Sprintf("uniform:%s-%s", t.Min, t.Max)
+	}
+	return t.Distribution + ":" + t.Min.String()
+}
+
+// Sample draws a think time from the distribution
+func (t *ThinkTime) Sample(rng *rand.Rand) time.Duration {
+	if t == nil {
+		return 0
+	}
+	switch t.Distribution {
+	case "uniform":
+		return t.Min + time.Duration(rng.Int63n(int64(t.Max-t.Min)+1))
+	case "exponential":
+		return time.Duration(rng.ExpFloat64() * float64(t.Min))
+	default:
+		return t.Min
+	}
+}
+
+// Session is the scripted sequence of requests that each virtual user repeats.
+// Every session starts afresh, without the values extracted by the last one,
+// and ends at its first failed step.
+type Session struct {
+	ThinkTime *ThinkTime     `yaml:"think_time,omitempty" json:"think_time"` // pause after every step
+	Steps     []*SessionStep `yaml:"steps" json:"steps"`                     // requests in order
+}
+
+// SessionStep is one request of a session: either a request of the scenario
+// given by name, or a request described in the step itself, which is then
+// only sent as part of the session
+type SessionStep struct {
+	Request     string     `yaml:"request,omitempty" json:"request"`       // name of a request of the scenario
+	ThinkTime   *ThinkTime `yaml:"think_time,omitempty" json:"think_time"` // overrides the session's think time
+	RequestSpec `yaml:",inline"`
+
+	spec *RequestSpec // resolved request
+}
+
+// SessionMetrics aggregates the sessions completed by virtual users
+type SessionMetrics struct {
+	Completed int        // sessions where every step succeeded
+	Failed    int        // sessions where a step returned an error or failed an assertion
+	Duration  *Histogram // wall time of a session, think time between its steps included
+}
+
+// NewSessionMetrics creates empty session metrics
+func NewSessionMetrics() *SessionMetrics {
+	return &SessionMetrics{Duration: NewHistogram()}
+}
+
+// Merge adds the sessions recorded in other
+func (m *SessionMetrics) Merge(other *SessionMetrics) {
+	m.Completed += other.Completed
+	m.Failed += other.Failed
+	m.Duration.Merge(other.Duration)
+}
+
+// VirtualUser runs the scenario's session in a closed loop: it waits for each
+// response, and then for a think time, before sending the next request
+type VirtualUser struct {
+	*Worker
+	profile   *Profile        // used to attribute results to a stage
+	thinkTime *ThinkTime      // default pause between steps, may be nil
+	sessions  *SessionMetrics // sessions run by this user
+}
+
+// NewVirtualUser creates a virtual user with the given parameters
+func NewVirtualUser(id int, scenario *Scenario, target Target, profile *Profile, thinkTime *ThinkTime, sinks ...ResultSink) *VirtualUser {
+	return &VirtualUser{
+		Worker:    NewWorker(id, scenario, target, sinks...),
+		profile:   profile,
+		thinkTime: thinkTime,
+		sessions:  NewSessionMetrics(),
+	}
+}
+
+// Run repeats the session until the end of the profile or until ctx is done.
+// A session ends early at its first failed step, as the steps after it may
+// depend on its response. A session cut short by the end of the run is not
+// counted.
+func (u *VirtualUser) Run(ctx context.Context, scheduler *ArrivalScheduler, runStart time.Time) {
+	deadline := runStart.Add(u.profile.Duration())
+	steps := u.scenario.SessionSteps()
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		u.runSession(ctx, scheduler, runStart, deadline, steps)
+	}
+}
+
+// runSession runs the steps of one session. A panic in a step, such as in a
+// template function, fails the session with the panic as the step's error
+// rather than ending the run.
+func (u *VirtualUser) runSession(ctx context.Context, scheduler *ArrivalScheduler, runStart, deadline time.Time, steps []*SessionStep) {
+	sessionStart := time.Now()
+	var spec *RequestSpec
+	stage, inFlight := 0, false
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if inFlight {
+			scheduler.release()
+		}
+		result := Result{WorkerID: u.id, Name: "session", Stage: stage, Start: time.Now(), Err: fmt.Errorf("panic: %v", r)}
+		if spec != nil {
+			result.Name, result.Method = spec.Name, spec.Method
+		}
+		u.record(result)
+		u.sessions.Failed++
+		u.sessions.Duration.Record(time.Since(sessionStart))
+		u.pause(ctx, u.thinkTime, deadline)
+	}()
+
+	// Every session starts without the values extracted by the last one
+	for name := range u.vars {
+		delete(u.vars, name)
+	}
+	// Feeder rows are kept for the whole session, so its steps work on the same data
+	data := u.scenario.NewTemplateData(u.vars, u.rng)
+	for i, step := range steps {
+		if !time.Now().Before(deadline) || ctx.Err() != nil {
+			return
+		}
+		spec = step.spec
+		if spec == nil {
+			spec = u.scenario.Pick(u.rng)
+		}
+
+		stage = u.profile.StageAt(time.Since(runStart))
+		scheduler.acquire(stage)
+		inFlight = true
+		result := u.send(spec, data)
+		result.Stage = stage
+		scheduler.release()
+		inFlight = false
+		u.record(result)
+		failed := result.Failed() || len(result.Failures) > 0
+
+		// The session ends with its last or first failed response; the
+		// pause after it separates it from the next one
+		last := failed || i == len(steps)-1
+		if last {
+			if failed {
+				u.sessions.Failed++
+			} else {
+				u.sessions.Completed++
+			}
+			u.sessions.Duration.Record(time.Since(sessionStart))
+		}
+		thinkTime := u.thinkTime
+		if step.ThinkTime != nil {
+			thinkTime = step.ThinkTime
+		}
+		u.pause(ctx, thinkTime, deadline)
+		if last {
+			return
+		}
+	}
+}
+
+// pause waits for a think time, at most until the deadline
+func (u *VirtualUser) pause(ctx context.Context, thinkTime *ThinkTime, deadline time.Time) {
+	pause := thinkTime.Sample(u.rng)
+	if remaining := time.Until(deadline); pause > remaining {
+		pause = remaining
+	}
+	sleepContext(ctx, pause)
+}
+
+// Sessions returns the sessions run by the user; it must only be called once
+// Run has returned
+func (u *VirtualUser) Sessions() *SessionMetrics {
+	return u.sessions
+}
+
+// runVirtualUsers runs the scenario's session with vus concurrent users until
+// the end of the profile or until ctx is done. Like runWorkers it returns the
+// merged metrics and the start and length of the run, along with the session
+// metrics.
+func runVirtualUsers(ctx context.Context, scenario *Scenario, target Target, scheduler *ArrivalScheduler, vus int, thinkTime *ThinkTime, sinks []ResultSink, live *IntervalRecorder, interval time.Duration, listeners []IntervalListener) (*Metrics, *SessionMetrics, time.Time, time.Duration) {
+	users := make([]*VirtualUser, vus)
+	for i := range users {
+		users[i] = NewVirtualUser(i, scenario, target, scheduler.profile, thinkTime, sinks...)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(vus)
+	runStart := time.Now()
+	for _, user := range users {
+		go func(user *VirtualUser) {
+			user.Run(ctx, scheduler, runStart)
+			wg.Done()
+		}(user)
+	}
+	var monitor *Monitor
+	if live != nil {
+		monitor = NewMonitor(interval, live, scheduler, listeners...)
+		go monitor.Run(runStart)
+	}
+
+	wg.Wait()
+	runDuration := time.Since(runStart)
+	if monitor != nil {
+		monitor.Stop()
+	}
+
+	metrics := NewMetrics()
+	sessions := NewSessionMetrics()
+	for _, user := range users {
+		metrics.Merge(user.Metrics())
+		sessions.Merge(user.Sessions())
+	}
+	return metrics, sessions, runStart, runDuration
+}
@@ -0,0 +1,51 @@
+package loadgen
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// panickyTarget panics on every other request and answers the others with 200
+type panickyTarget struct {
+	calls atomic.Int64
+}
+
+func (t *panickyTarget) Send(ctx context.Context, spec *RequestSpec, data *TemplateData, vars map[string]string) Result {
+	if t.calls.Add(1)%2 == 0 {
+		panic("broken template")
+	}
+	return Result{Name: spec.Name, Method: spec.Method, Start: time.Now(), Status: 200}
+}
+
+func TestVirtualUserRecoversPerSession(t *testing.T) {
+	scenario := &Scenario{
+		Session: &Session{Steps: []*SessionStep{
+			{RequestSpec: RequestSpec{Name: "first", Path: "/"}},
+			{RequestSpec: RequestSpec{Name: "second", Path: "/"}},
+		}},
+	}
+	if err := scenario.Prepare("http://localhost"); err != nil {
+		t.Fatal(err)
+	}
+	profile := ConstantProfile(1, 200*time.Millisecond)
+	if err := profile.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	scheduler := NewArrivalScheduler(profile, 1)
+
+	metrics, sessions, _, _ := runVirtualUsers(context.Background(), scenario, &panickyTarget{}, scheduler, 1, nil, nil, nil, time.Second, nil)
+	if sessions.Failed == 0 || sessions.Completed != 0 {
+		t.Errorf("%d completed and %d failed sessions, want only failed ones", sessions.Completed, sessions.Failed)
+	}
+	if metrics.Errors != sessions.Failed {
+		t.Errorf("recorded %d errors, want one per failed session (%d)", metrics.Errors, sessions.Failed)
+	}
+	if scheduler.InFlight() != 0 {
+		t.Errorf("%d in-flight slots left taken", scheduler.InFlight())
+	}
+	if sent := scheduler.Stats().Sent; sent != int64(metrics.Requests) {
+		t.Errorf("counted %d sent, want %d", sent, metrics.Requests)
+	}
+}
@@ -0,0 +1,166 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Worker is a struct that represents a concurrent worker
+type Worker struct {
+	id       int          // worker id
+	scenario *Scenario    // requests to choose from
+	target   Target       // sends the requests
+	rng      *rand.Rand   // per-worker source for picking requests
+	metrics  *Metrics     // results recorded by this worker
+	sinks    []ResultSink // shared consumers of every result
+
+	vars map[string]string // values extracted from responses, for the later steps of a virtual user's session
+}
+
+// Result is a struct that holds the result of a request
+type Result struct {
+	WorkerID int           // worker id
+	Name     string        // name of the scenario request
+	Stage    int           // index of the profile stage
+	Method   string        // HTTP method
+	URL      string        // rendered request url
+	Start    time.Time     // time the request was sent
+	Status   int           // status code
+	Latency  time.Duration // latency, from the time the request was scheduled in open-loop runs
+	Wait     time.Duration // time the request was sent behind its schedule, included in Latency
+	Err      error         // error if any
+	Size     int64         // length of the response body
+	Failures []string      // assertions the response failed
+	Phases   Phases        // connection timing breakdown
+}
+
+// Failed reports whether the request is counted as an error: it returned a
+// transport error, or the server answered with a 5xx status
+func (r Result) Failed() bool {
+	return r.Err != nil || r.Status >= 500
+}
+
+// ResultSink receives every result as soon as it is recorded. Sinks are
+// shared by all workers, so Record must be safe for concurrent use.
+type ResultSink interface {
+	Record(result Result)
+}
+
+// NewWorker creates a new worker with the given parameters
+func NewWorker(id int, scenario *Scenario, target Target, sinks ...ResultSink) *Worker {
+	return &Worker{
+		id:       id,
+		scenario: scenario,
+		target:   target,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano() + int64(id))),
+		metrics:  NewMetrics(),
+		sinks:    sinks,
+		vars:     make(map[string]string),
+	}
+}
+
+// Run takes ticks from the scheduler until the channel is closed, making one
+// request per tick and recording the result in the worker's own metrics. Once
+// ctx is done, the ticks still queued are released without a request.
+func (w *Worker) Run(ctx context.Context, ticks <-chan Tick) {
+	defer func() {
+		// handle panic gracefully
+		if r := recover(); r != nil {
+			fmt.Println("Worker", w.id, "panicked:", r)
+		}
+	}()
+
+	for tick := range ticks {
+		if ctx.Err() != nil {
+			tick.Done()
+			continue
+		}
+		spec := tick.request
+		if spec == nil {
+			spec = w.scenario.Pick(w.rng)
+		}
+		result := w.send(spec, w.scenario.NewTemplateData(w.vars, w.rng))
+		result.Stage = tick.stage
+		// Latency counts from the schedule, so a request held up by the client
+		// shows the delay its user would have seen (coordinated omission)
+		if !tick.scheduled.IsZero() && result.Start.After(tick.scheduled) {
+			result.Wait = result.Start.Sub(tick.scheduled)
+			result.Latency += result.Wait
+		}
+		w.record(result)
+		tick.Done()
+	}
+}
+
+// record adds a result to the worker's metrics and hands it to the sinks
+func (w *Worker) record(result Result) {
+	w.metrics.Record(result)
+	for _, sink := range w.sinks {
+		sink.Record(result)
+	}
+}
+
+// send makes a single request rendered with data through the worker's target
+func (w *Worker) send(spec *RequestSpec, data *TemplateData) Result {
+	// Requests already in flight are left to complete when the run is stopped
+	result := w.target.Send(context.Background(), spec, data, w.vars)
+	result.WorkerID = w.id
+	return result
+}
+
+// Metrics returns the results recorded by the worker; it must only be called
+// once Run has returned
+func (w *Worker) Metrics() *Metrics {
+	return w.metrics
+}
+
+// runWorkers runs the profile of the scheduler in this process with one
+// worker per allowed in-flight request, until the end of the profile or until
+// ctx is done; requests already in flight are then left to complete. If live
+// is set, a monitor hands its windows to the listeners every interval. It
+// returns the merged metrics of the workers and the start and length of the run.
+func runWorkers(ctx context.Context, scenario *Scenario, target Target, scheduler Scheduler, maxInFlight int, sinks []ResultSink, live *IntervalRecorder, interval time.Duration, listeners []IntervalListener) (*Metrics, time.Time, time.Duration) {
+	// Create the channel the scheduler hands ticks out on
+	ticks := make(chan Tick, maxInFlight)
+
+	// Create a wait group for workers
+	wg := &sync.WaitGroup{}
+	wg.Add(maxInFlight)
+
+	// Create and run workers, one per allowed in-flight request
+	workers := make([]*Worker, maxInFlight)
+	for i := range workers {
+		worker := NewWorker(i, scenario, target, sinks...)
+		workers[i] = worker
+		go func() {
+			worker.Run(ctx, ticks)
+			wg.Done()
+		}()
+	}
+
+	// Start firing ticks on the arrival schedule
+	runStart := time.Now()
+	go scheduler.Run(ctx, ticks)
+	var monitor *Monitor
+	if live != nil {
+		monitor = NewMonitor(interval, live, scheduler, listeners...)
+		go monitor.Run(runStart)
+	}
+
+	// Wait for all workers to finish
+	wg.Wait()
+	runDuration := time.Since(runStart)
+	if monitor != nil {
+		monitor.Stop()
+	}
+
+	// Merge the metrics recorded by each worker
+	metrics := NewMetrics()
+	for _, worker := range workers {
+		metrics.Merge(worker.Metrics())
+	}
+	return metrics, runStart, runDuration
+}
@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Bappy60/BookStore_in_Go/pkg/domain"
+	"github.com/Bappy60/BookStore_in_Go/pkg/models"
+	"github.com/Bappy60/BookStore_in_Go/pkg/types"
+)
+
+// MemoryStore keeps books and authors in memory instead of the database, for
+// tests and in-process load tests. The book and author repos of a store share
+// its data, so books carry their authors and deleting an author deletes
+// their books.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	books        map[uint]models.Book
+	authors      map[uint]models.Author
+	nextBookID   uint
+	nextAuthorID uint
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		books:   make(map[uint]models.Book),
+		authors: make(map[uint]models.Author),
+	}
+}
+
+type bookMemoryRepo struct {
+	store *MemoryStore
+}
+
+func BookMemoryInstance(store *MemoryStore) domain.IBookRepo {
+	return &bookMemoryRepo{
+		store: store,
+	}
+}
+
+type authorMemoryRepo struct {
+	store *MemoryStore
+}
+
+func AuthorMemoryInstance(store *MemoryStore) domain.IAuthorRepo {
+	return &authorMemoryRepo{
+		store: store,
+	}
+}
+
+// containsFold matches like a LIKE '%value%' query on a case-insensitive column
+func containsFold(s, value string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(value))
+}
+
+// bookWithAuthor returns a copy of a book with its author preloaded; the
+// store must be locked
+func (store *MemoryStore) bookWithAuthor(book models.Book) models.Book {
+	book.Author = store.authors[book.AuthorID]
+	book.Author.Books = nil
+	return book
+}
+
+func (repo *bookMemoryRepo) GetAllBooks() ([]models.Book, error) {
+	return repo.GetBooks(&types.FilterBookStruc{})
+}
+
+func (repo *bookMemoryRepo) GetBooks(filterStruct *types.FilterBookStruc) ([]models.Book, error) {
+	store := repo.store
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var Books []models.Book
+	for _, book := range store.books {
+		if filterStruct.ID != 0 {
+			if book.ID == filterStruct.ID {
+				Books = append(Books, store.bookWithAuthor(book))
+			}
+			continue
+		}
+		if filterStruct.Name != nil && *filterStruct.Name != "" && !containsFold(book.Name, *filterStruct.Name) {
+			continue
+		}
+		if filterStruct.AuthorID != nil && *filterStruct.AuthorID != 0 && book.AuthorID != *filterStruct.AuthorID {
+			continue
+		}
+		if filterStruct.Publication != nil && *filterStruct.Publication != "" && !strings.EqualFold(book.Publication, *filterStruct.Publication) {
+			continue
+		}
+		if filterStruct.PublicationYear != 0 && book.PublicationYear != filterStruct.PublicationYear {
+			continue
+		}
+		if filterStruct.NumberOfPages != 0 && book.NumberOfPages != filterStruct.NumberOfPages {
+			continue
+		}
+		Books = append(Books, store.bookWithAuthor(book))
+	}
+	sort.Slice(Books, func(i, j int) bool { return Books[i].ID < Books[j].ID })
+	return Books, nil
+}
+
+func (repo *bookMemoryRepo) CreateBook(newBook *types.CreateBookStruc) (*models.Book, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, book := range store.books {
+		if book.Name == newBook.Name && book.AuthorID == newBook.AuthorID {
+			return nil, errors.New("book already exists")
+		}
+	}
+	if _, ok := store.authors[newBook.AuthorID]; !ok {
+		return nil, errors.New("no author found with given ID")
+	}
+
+	store.nextBookID++
+	Book := models.Book{
+		ID:              store.nextBookID,
+		Name:            newBook.Name,
+		Publication:     newBook.Publication,
+		PublicationYear: newBook.PublicationYear,
+		AuthorID:        newBook.AuthorID,
+		NumberOfPages:   newBook.NumberOfPages,
+	}
+	store.books[Book.ID] = Book
+	return &Book, nil
+}
+
+func (repo *bookMemoryRepo) UpdateBook(updateBook *models.Book) (*models.Book, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	bookDetails, ok := store.books[updateBook.ID]
+	if !ok {
+		return nil, errors.New("no book found with given ID")
+	}
+	if updateBook.Name != "" {
+		bookDetails.Name = updateBook.Name
+	}
+	if updateBook.NumberOfPages != 0 {
+		bookDetails.NumberOfPages = updateBook.NumberOfPages
+	}
+	if updateBook.PublicationYear != 0 {
+		bookDetails.PublicationYear = updateBook.PublicationYear
+	}
+	if updateBook.Publication != "" {
+		bookDetails.Publication = updateBook.Publication
+	}
+	store.books[bookDetails.ID] = bookDetails
+	return &bookDetails, nil
+}
+
+func (repo *bookMemoryRepo) DeleteBook(bookID int64) (string, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.books[uint(bookID)]; !ok {
+		return "", errors.New("no book found with given ID")
+	}
+	delete(store.books, uint(bookID))
+	return "Delete successful", nil
+}
+
+// authorWithBooks returns a copy of an author with their books preloaded; the
+// store must be locked
+func (store *MemoryStore) authorWithBooks(author models.Author) models.Author {
+	author.Books = nil
+	for _, book := range store.books {
+		if book.AuthorID == author.ID {
+			author.Books = append(author.Books, book)
+		}
+	}
+	sort.Slice(author.Books, func(i, j int) bool { return author.Books[i].ID < author.Books[j].ID })
+	return author
+}
+
+func (repo *authorMemoryRepo) GetAuthor(authorStruc *types.FilterAuthorStruc) ([]models.Author, error) {
+	store := repo.store
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var Authors []models.Author
+	for _, author := range store.authors {
+		if authorStruc.ID != 0 {
+			if author.ID == authorStruc.ID {
+				Authors = append(Authors, store.authorWithBooks(author))
+			}
+			continue
+		}
+		if authorStruc.Name != "" && !containsFold(author.Name, authorStruc.Name) {
+			continue
+		}
+		if authorStruc.Email != "" && !containsFold(author.Email, authorStruc.Email) {
+			continue
+		}
+		if authorStruc.Age != 0 && int64(author.Age) != authorStruc.Age {
+			continue
+		}
+		Authors = append(Authors, store.authorWithBooks(author))
+	}
+	sort.Slice(Authors, func(i, j int) bool { return Authors[i].ID < Authors[j].ID })
+	return Authors, nil
+}
+
+func (repo *authorMemoryRepo) CreateAuthor(newAuthor *types.CreateAuthorStruc) (*models.Author, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, author := range store.authors {
+		if author.Name == newAuthor.Name && author.Email == newAuthor.Email {
+			return nil, errors.New("author already exists")
+		}
+		// email is a unique column
+		if author.Email == newAuthor.Email {
+			return nil, errors.New("email already in use")
+		}
+	}
+
+	store.nextAuthorID++
+	author := models.Author{
+		ID:    store.nextAuthorID,
+		Name:  newAuthor.Name,
+		Email: newAuthor.Email,
+		Age:   newAuthor.Age,
+	}
+	store.authors[author.ID] = author
+	return &author, nil
+}
+
+func (repo *authorMemoryRepo) UpdateAuthor(updateAuthor *models.Author) (*models.Author, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	AuthorDetails, ok := store.authors[updateAuthor.ID]
+	if !ok {
+		return nil, errors.New("no author found with given ID")
+	}
+	if updateAuthor.Name != "" {
+		AuthorDetails.Name = updateAuthor.Name
+	}
+	if updateAuthor.Email != "" {
+		AuthorDetails.Email = updateAuthor.Email
+	}
+	if updateAuthor.Age != 0 {
+		AuthorDetails.Age = updateAuthor.Age
+	}
+	store.authors[AuthorDetails.ID] = AuthorDetails
+	return &AuthorDetails, nil
+}
+
+func (repo *authorMemoryRepo) DeleteAuthor(ID int64) (string, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.authors[uint(ID)]; !ok {
+		return "", errors.New("no author found with given ID")
+	}
+	delete(store.authors, uint(ID))
+	// books are deleted with their author, like the database cascade
+	for id, book := range store.books {
+		if book.AuthorID == uint(ID) {
+			delete(store.books, id)
+		}
+	}
+	return "Delete successful", nil
+}